@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// Deploy policies for a create or rollback arriving while the app is still
+// deploying.
+// With supersede, the default, older deployments still building are
+// cancelled so only the newest goes on; with queue they all run in turn.
+// Either way only one deployment per app runs its pipeline at a time.
+const (
+	policySupersede = "supersede"
+	policyQueue     = "queue"
+)
+
+func deployPolicy() string {
+	if os.Getenv("DEPLOY_POLICY") == policyQueue {
+		return policyQueue
+	}
+	return policySupersede
+}
+
+var errCancelledByUser = errors.New("cancelled by user")
+
+type build struct {
+	app    string
+	cancel context.CancelCauseFunc
+	// building is true until the deployment has moved on to deploying,
+	// only then can it be cancelled or superseded
+	building bool
+}
+
+// builds maps the depid of every deployment pipeline and rollback running
+// in this worker to the cancel func of its context, so a cancel request or
+// a newer deploy can reach it while it is still building or waiting.
+var builds = struct {
+	sync.Mutex
+	byDepID map[string]*build
+}{byDepID: map[string]*build{}}
+
+// trackBuild registers a deployment of app. Under the supersede policy the
+// app's other deployments still building are cancelled, their depids are
+// returned.
+func trackBuild(app string, depid string, cancel context.CancelCauseFunc) (superseded []string) {
+	builds.Lock()
+	defer builds.Unlock()
+
+	if deployPolicy() == policySupersede {
+		for other, b := range builds.byDepID {
+			if b.app != app || !b.building {
+				continue
+			}
+			b.cancel(fmt.Errorf("superseded by deployment %s", depid))
+			delete(builds.byDepID, other)
+			superseded = append(superseded, other)
+		}
+	}
+	builds.byDepID[depid] = &build{app: app, cancel: cancel, building: true}
+	return superseded
+}
+
+// finishBuild ends the cancellable part of deployment depid. It reports
+// false when the deployment was cancelled or superseded first, the pipeline
+// must not deploy then.
+func finishBuild(depid string) bool {
+	builds.Lock()
+	defer builds.Unlock()
+
+	b, ok := builds.byDepID[depid]
+	if !ok || !b.building {
+		return false
+	}
+	b.building = false
+	return true
+}
+
+// untrackBuild is called when the pipeline of depid returns.
+func untrackBuild(depid string) {
+	builds.Lock()
+	defer builds.Unlock()
+	delete(builds.byDepID, depid)
+}
+
+// stopBuild cancels deployment depid. found is false when no pipeline in
+// this worker runs it; stopped is false when it is past its build.
+func stopBuild(depid string) (found bool, stopped bool) {
+	builds.Lock()
+	defer builds.Unlock()
+
+	b, ok := builds.byDepID[depid]
+	if !ok {
+		return false, false
+	}
+	if !b.building {
+		return true, false
+	}
+	b.cancel(errCancelledByUser)
+	delete(builds.byDepID, depid)
+	return true, true
+}
+
+type appLock struct {
+	held   chan struct{}
+	holder string
+}
+
+// appLocks holds one lock per app, taken for the whole deployment pipeline
+// so two deployments never build or roll out the same app at once.
+var appLocks = struct {
+	sync.Mutex
+	byApp map[string]*appLock
+}{byApp: map[string]*appLock{}}
+
+// lockApp takes the deploy lock of app for deployment depid, calling
+// waiting with the holder's depid first when it is busy. It gives up with
+// ctx's error once ctx ends. The returned func releases the lock.
+func lockApp(ctx context.Context, app string, depid string, waiting func(holder string)) (func(), error) {
+	appLocks.Lock()
+	lock, ok := appLocks.byApp[app]
+	if !ok {
+		lock = &appLock{held: make(chan struct{}, 1)}
+		appLocks.byApp[app] = lock
+	}
+	holder := lock.holder
+	appLocks.Unlock()
+
+	select {
+	case lock.held <- struct{}{}:
+	default:
+		if holder != "" {
+			waiting(holder)
+		}
+		select {
+		case lock.held <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	appLocks.Lock()
+	lock.holder = depid
+	appLocks.Unlock()
+	log.Printf("deploy lock of %s taken by %s", app, depid)
+
+	return func() {
+		appLocks.Lock()
+		lock.holder = ""
+		appLocks.Unlock()
+		<-lock.held
+	}, nil
+}
@@ -0,0 +1,110 @@
+package create
+
+import (
+	"context"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// Autoscale is the opt-in autoscaling policy of an app. CPU and Memory are
+// target average utilization in percent of the requests, 0 leaves that
+// metric out. Utilization needs metrics-server in the cluster.
+type Autoscale struct {
+	Min    int32
+	Max    int32
+	CPU    int32
+	Memory int32
+}
+
+func HPAName(appname string) string {
+	return appname + "-hpa"
+}
+
+func (a Autoscale) metrics() []autoscalingv2.MetricSpec {
+	var metrics []autoscalingv2.MetricSpec
+	add := func(name corev1.ResourceName, target int32) {
+		if target <= 0 {
+			return
+		}
+		metrics = append(metrics, autoscalingv2.MetricSpec{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{
+				Name: name,
+				Target: autoscalingv2.MetricTarget{
+					Type:               autoscalingv2.UtilizationMetricType,
+					AverageUtilization: int32Ptr(target),
+				},
+			},
+		})
+	}
+	add(corev1.ResourceCPU, a.CPU)
+	add(corev1.ResourceMemory, a.Memory)
+	return metrics
+}
+
+// ApplyAutoscale creates or updates the HPA scaling the app Deployment.
+// created reports whether the HPA is new.
+func ApplyAutoscale(client kubernetes.Interface, appname string, policy Autoscale) (created bool, err error) {
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      HPAName(appname),
+			Namespace: appname,
+		},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       appname,
+			},
+			MinReplicas: int32Ptr(policy.Min),
+			MaxReplicas: policy.Max,
+			Metrics:     policy.metrics(),
+		},
+	}
+
+	hpas := client.AutoscalingV2().HorizontalPodAutoscalers(appname)
+	_, err = hpas.Create(context.Background(), hpa, metav1.CreateOptions{})
+	if !apierrors.IsAlreadyExists(err) {
+		return err == nil, err
+	}
+
+	return false, retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := hpas.Get(context.Background(), hpa.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		existing.Spec = hpa.Spec
+		_, err = hpas.Update(context.Background(), existing, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// DeploymentExists reports whether the app is currently deployed.
+func DeploymentExists(client kubernetes.Interface, appname string) (bool, error) {
+	_, err := client.AppsV1().Deployments(appname).Get(context.Background(), appname, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// DeleteAutoscale removes the app HPA, an app without one is fine.
+func DeleteAutoscale(client kubernetes.Interface, appname string) error {
+	err := deleteHPA(client, appname)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// deleteHPA is DeleteAutoscale passing NotFound on, for the delete summary.
+func deleteHPA(client kubernetes.Interface, appname string) error {
+	return client.AutoscalingV2().
+		HorizontalPodAutoscalers(appname).
+		Delete(context.Background(), HPAName(appname), metav1.DeleteOptions{})
+}
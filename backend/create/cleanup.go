@@ -0,0 +1,93 @@
+package create
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Kinds of resources a pipeline run can create.
+const (
+	ResourceNamespace  = "namespace"
+	ResourceDeployment = "deployment"
+	ResourceHPA        = "hpa"
+	ResourceService    = "service"
+)
+
+// Created records the app resources one pipeline run created, in order, so
+// a first deploy that fails halfway can be undone. Resources that existed
+// before the run are never recorded and so never removed.
+type Created struct {
+	client  kubernetes.Interface
+	appname string
+	kinds   []string
+}
+
+func NewCreated(client kubernetes.Interface, appname string) *Created {
+	return &Created{client: client, appname: appname}
+}
+
+// Add records kind when created is true, so callers can pass the result of
+// the create call straight through.
+func (c *Created) Add(kind string, created bool) {
+	if created {
+		c.kinds = append(c.kinds, kind)
+	}
+}
+
+func (c *Created) Empty() bool {
+	return len(c.kinds) == 0
+}
+
+// Undo removes the recorded resources newest first. A namespace created by
+// the run takes everything in it along, so nothing else is deleted then.
+// It returns the kinds removed and the first error hit; it keeps going past
+// errors so as much as possible is cleaned.
+func (c *Created) Undo() (removed []string, err error) {
+	for i := len(c.kinds) - 1; i >= 0; i-- {
+		if c.kinds[i] == ResourceNamespace {
+			if err := DeleteNamespace(c.client, c.appname); err != nil {
+				return removed, fmt.Errorf("namespace: %w", err)
+			}
+			c.kinds = nil
+			return append(removed, ResourceNamespace), nil
+		}
+	}
+
+	for i := len(c.kinds) - 1; i >= 0; i-- {
+		kind := c.kinds[i]
+		if e := c.remove(kind); e != nil {
+			if err == nil {
+				err = fmt.Errorf("%s: %w", kind, e)
+			}
+			continue
+		}
+		removed = append(removed, kind)
+	}
+	c.kinds = nil
+	return removed, err
+}
+
+func (c *Created) remove(kind string) error {
+	ctx := context.Background()
+	var err error
+
+	switch kind {
+	case ResourceDeployment:
+		err = c.client.AppsV1().Deployments(c.appname).Delete(ctx, c.appname, metav1.DeleteOptions{})
+	case ResourceHPA:
+		err = DeleteAutoscale(c.client, c.appname)
+	case ResourceService:
+		err = c.client.CoreV1().Services(c.appname).Delete(ctx, c.appname+"-service", metav1.DeleteOptions{})
+	default:
+		return fmt.Errorf("unknown resource kind %q", kind)
+	}
+
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
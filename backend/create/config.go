@@ -0,0 +1,87 @@
+package create
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ConfigHashAnnotation on the pod template changes whenever the app config
+// changes, which is what rolls the pods onto the new environment.
+const ConfigHashAnnotation = "forgepaas.io/config-hash"
+
+func ConfigMapName(appname string) string {
+	return appname + "-config"
+}
+
+// ConfigHash is a stable digest of the config values.
+func ConfigHash(data map[string]string) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%s\n", k, data[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// ApplyConfig writes the app environment to the <app>-config ConfigMap in
+// the app namespace, creating namespace and ConfigMap as needed.
+func ApplyConfig(client kubernetes.Interface, appname string, data map[string]string) error {
+	if err := Createnamespace(client, appname); err != nil {
+		return err
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ConfigMapName(appname),
+			Namespace: appname,
+		},
+		Data: data,
+	}
+
+	configmaps := client.CoreV1().ConfigMaps(appname)
+	_, err := configmaps.Create(context.Background(), cm, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		_, err = configmaps.Update(context.Background(), cm, metav1.UpdateOptions{})
+	}
+	return err
+}
+
+// RestartForConfig stamps the config hash on the running Deployment, which
+// triggers a rolling restart. It reports false when the app is not deployed.
+func RestartForConfig(client kubernetes.Interface, appname string, hash string) (bool, error) {
+	return restartWithAnnotation(client, appname, ConfigHashAnnotation, hash)
+}
+
+// RestartForSecrets does the same for a new secrets resourceVersion.
+func RestartForSecrets(client kubernetes.Interface, appname string, version string) (bool, error) {
+	return restartWithAnnotation(client, appname, SecretsVersionAnnotation, version)
+}
+
+func restartWithAnnotation(client kubernetes.Interface, appname string, key string, value string) (bool, error) {
+	patch := fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`, key, value)
+
+	_, err := client.AppsV1().
+		Deployments(appname).
+		Patch(context.Background(), appname, types.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -8,7 +8,6 @@ import (
 	k8serr "k8s.io/apimachinery/pkg/api/errors"
 
 	appv1 "k8s.io/api/apps/v1"
-	autoscalingv1 "k8s.io/api/autoscaling/v1"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -21,19 +20,29 @@ import (
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
 )
 
+// DepIDAnnotation records on the pod template which deployment produced it.
+const DepIDAnnotation = "forgepaas.io/depid"
+
 func int64Ptr(i int64) *int64 {
 	return &i
 }
 func int32Ptr(i int32) *int32 {
 	return &i
 }
+func boolPtr(b bool) *bool {
+	return &b
+}
 
-func CreateDep(image_url string, depid string, appname string) *appv1.Deployment {
+// CreateDep builds the app Deployment. The container gets PORT set to port,
+// which is also what the probe, Service and route target.
+func CreateDep(image_url string, depid string, appname string, port int32) *appv1.Deployment {
 	maxSurge := intstr.FromInt(1)
 	maxUnavailable := intstr.FromInt(0)
 	label := map[string]string{"app": appname}
+	annotations := map[string]string{DepIDAnnotation: depid}
 
 	dep := &appv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
@@ -41,7 +50,7 @@ func CreateDep(image_url string, depid string, appname string) *appv1.Deployment
 			Namespace: appname,
 		},
 		Spec: appv1.DeploymentSpec{
-			Replicas: int32Ptr(2),
+			Replicas: int32Ptr(DefaultReplicas),
 
 			Selector: &metav1.LabelSelector{
 				MatchLabels: label,
@@ -55,7 +64,8 @@ func CreateDep(image_url string, depid string, appname string) *appv1.Deployment
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: label,
+					Labels:      label,
+					Annotations: annotations,
 				},
 				Spec: corev1.PodSpec{
 					TerminationGracePeriodSeconds: int64Ptr(120),
@@ -65,9 +75,26 @@ func CreateDep(image_url string, depid string, appname string) *appv1.Deployment
 							Name:  "dep",
 							Image: image_url,
 
+							Env: portEnv(port),
+
+							EnvFrom: []corev1.EnvFromSource{
+								{
+									ConfigMapRef: &corev1.ConfigMapEnvSource{
+										LocalObjectReference: corev1.LocalObjectReference{Name: ConfigMapName(appname)},
+										Optional:             boolPtr(true),
+									},
+								},
+								{
+									SecretRef: &corev1.SecretEnvSource{
+										LocalObjectReference: corev1.LocalObjectReference{Name: SecretName(appname)},
+										Optional:             boolPtr(true),
+									},
+								},
+							},
+
 							Ports: []corev1.ContainerPort{
 								{
-									ContainerPort: 8080,
+									ContainerPort: port,
 								},
 							},
 
@@ -81,16 +108,6 @@ func CreateDep(image_url string, depid string, appname string) *appv1.Deployment
 									corev1.ResourceMemory: resource.MustParse("500Mi"),
 								},
 							},
-
-							LivenessProbe: &corev1.Probe{
-								InitialDelaySeconds: 30,
-								PeriodSeconds:       10,
-								ProbeHandler: corev1.ProbeHandler{
-									TCPSocket: &corev1.TCPSocketAction{
-										Port: intstr.FromInt(8080),
-									},
-								},
-							},
 						},
 					},
 				},
@@ -98,10 +115,15 @@ func CreateDep(image_url string, depid string, appname string) *appv1.Deployment
 		},
 	}
 
+	SetProbes(dep, HealthCheck{}, port)
+
 	return dep
 }
 
-func CreateService(client kubernetes.Interface, namespace string, appname string) error {
+// CreateService exposes the app on port. A redeploy keeps the existing
+// Service but moves it to port if that changed. created reports whether the
+// Service is new.
+func CreateService(client kubernetes.Interface, namespace string, appname string, port int32) (created bool, err error) {
 
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
@@ -112,135 +134,112 @@ func CreateService(client kubernetes.Interface, namespace string, appname string
 			Selector: map[string]string{
 				"app": appname,
 			},
-			Ports: []corev1.ServicePort{
-				{
-					Port:       8080,
-					TargetPort: intstr.FromInt(8080),
-				},
-			},
+			Ports: servicePorts(port),
 		},
 	}
 
-	_, err := client.CoreV1().
-		Services(namespace).
-		Create(context.Background(), service, metav1.CreateOptions{})
+	services := client.CoreV1().Services(namespace)
+	_, err = services.Create(context.Background(), service, metav1.CreateOptions{})
+	if !apierrors.IsAlreadyExists(err) {
+		return err == nil, err
+	}
 
-	return err
+	return false, retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := services.Get(context.Background(), service.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if len(existing.Spec.Ports) == 1 && existing.Spec.Ports[0].Port == port {
+			return nil
+		}
+		existing.Spec.Ports = servicePorts(port)
+		_, err = services.Update(context.Background(), existing, metav1.UpdateOptions{})
+		return err
+	})
 }
 
-func DeplomentRunner(client kubernetes.Interface, dep *appv1.Deployment, appname string) (*appv1.Deployment, error) {
+// DeplomentRunner creates the app Deployment, or when the app already exists
+// rolls the existing one onto the new pod template. The replica count of an
+// existing Deployment is kept. updated reports whether it was a redeploy.
+func DeplomentRunner(client kubernetes.Interface, dep *appv1.Deployment, appname string) (result *appv1.Deployment, updated bool, err error) {
 
-	err := Createnamespace(client, appname)
+	err = Createnamespace(client, appname)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	create, err := client.AppsV1().Deployments(appname).Create(context.Background(), dep, metav1.CreateOptions{})
-	if err != nil {
-		return nil, err
+	deployments := client.AppsV1().Deployments(appname)
+
+	result, err = deployments.Create(context.Background(), dep, metav1.CreateOptions{})
+	if err == nil {
+		return result, false, nil
+	}
+	if !apierrors.IsAlreadyExists(err) {
+		return nil, false, err
 	}
-	return create, nil
 
-}
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := deployments.Get(context.Background(), dep.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
 
-func InstDelete(client kubernetes.Interface, dynclient dynamic.Interface, namespace string, appname string) error {
-	route := appname + "-route"
-	ingressRouteRes := schema.GroupVersionResource{
-		Group:    "traefik.io",
-		Version:  "v1alpha1",
-		Resource: "ingressroutes",
-	}
-	grace := int64(30)
-	service := appname + "-service"
-	err := client.AppsV1().
-		Deployments(namespace).
-		Delete(
-			context.Background(),
-			appname,
-			metav1.DeleteOptions{
-				GracePeriodSeconds: &grace,
-			},
-		)
-	if err != nil {
+		existing.Spec.Template = dep.Spec.Template
+		existing.Spec.Strategy = dep.Spec.Strategy
+
+		result, err = deployments.Update(context.Background(), existing, metav1.UpdateOptions{})
 		return err
-	}
-	errr := client.CoreV1().Services(appname).Delete(context.Background(), service, metav1.DeleteOptions{})
-	if errr != nil {
-		return errr
-	}
-	errrr := dynclient.Resource(ingressRouteRes).Delete(context.Background(), route, metav1.DeleteOptions{})
-	if errrr != nil {
-		return errrr
-	}
-	err = DeleteNamespace(client, appname)
+	})
 	if err != nil {
-		return err
+		return nil, true, err
 	}
-	return nil
+	return result, true, nil
 
 }
 
-func Deletegracefully(client kubernetes.Interface, dynclient dynamic.Interface, namespace string, appname string) error {
-
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
-
-	serviceName := appname + "-service"
-	routeName := appname + "-route"
-
-	ingressRouteRes := schema.GroupVersionResource{
-		Group:    "traefik.io",
-		Version:  "v1alpha1",
-		Resource: "ingressroutes",
-	}
+// SetImage points the running app Deployment at an already built image
+// without touching the rest of the pod template. Used for rollbacks.
+func SetImage(client kubernetes.Interface, appname string, image string, depid string) (*appv1.Deployment, error) {
+	deployments := client.AppsV1().Deployments(appname)
 
-	replicas := int32(0)
-	_, err := client.AppsV1().
-		Deployments(namespace).
-		UpdateScale(
-			ctx,
-			appname,
-			&autoscalingv1.Scale{
-				Spec: autoscalingv1.ScaleSpec{Replicas: replicas},
-			},
-			metav1.UpdateOptions{},
-		)
-	if err != nil {
-		return err
-	}
-
-	_ = dynclient.
-		Resource(ingressRouteRes).
-		Namespace(namespace).
-		Delete(ctx, routeName, metav1.DeleteOptions{})
+	var result *appv1.Deployment
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := deployments.Get(context.Background(), appname, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
 
-	_ = client.CoreV1().
-		Services(namespace).
-		Delete(ctx, serviceName, metav1.DeleteOptions{})
+		for i := range existing.Spec.Template.Spec.Containers {
+			if existing.Spec.Template.Spec.Containers[i].Name == "dep" {
+				existing.Spec.Template.Spec.Containers[i].Image = image
+			}
+		}
+		if existing.Spec.Template.Annotations == nil {
+			existing.Spec.Template.Annotations = map[string]string{}
+		}
+		existing.Spec.Template.Annotations[DepIDAnnotation] = depid
 
-	err = client.AppsV1().
-		Deployments(namespace).
-		Delete(ctx, appname, metav1.DeleteOptions{})
-	if err != nil {
+		result, err = deployments.Update(context.Background(), existing, metav1.UpdateOptions{})
 		return err
-	}
-	err = DeleteNamespace(client, appname)
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return result, nil
+}
 
-	return nil
+var ingressRouteRes = schema.GroupVersionResource{
+	Group:    "traefik.io",
+	Version:  "v1alpha1",
+	Resource: "ingressroutes",
 }
 
-func CreateRoute(client dynamic.Interface, appname string, domain string, namespace string) error {
+// CreateRoute routes <app>.<domain> to the app Service on port. A redeploy
+// keeps the existing route but moves it to port if that changed. created
+// reports whether the route is new.
+func CreateRoute(client dynamic.Interface, appname string, domain string, namespace string, port int32) (created bool, err error) {
 	domain = appname + "." + domain
 
-	ingressRouteRes := schema.GroupVersionResource{
-		Group:    "traefik.io",
-		Version:  "v1alpha1",
-		Resource: "ingressroutes",
-	}
-
 	route := &unstructured.Unstructured{
 		Object: map[string]interface{}{
 			"apiVersion": "traefik.io/v1alpha1",
@@ -258,7 +257,7 @@ func CreateRoute(client dynamic.Interface, appname string, domain string, namesp
 						"services": []map[string]interface{}{
 							{
 								"name": appname + "-service",
-								"port": 8080,
+								"port": int64(port),
 							},
 						},
 					},
@@ -267,11 +266,31 @@ func CreateRoute(client dynamic.Interface, appname string, domain string, namesp
 		},
 	}
 
-	route, err := client.Resource(ingressRouteRes).Namespace(namespace).Create(context.TODO(), route, metav1.CreateOptions{})
-	return err
+	routes := client.Resource(ingressRouteRes).Namespace(namespace)
+	_, err = routes.Create(context.TODO(), route, metav1.CreateOptions{})
+	if !apierrors.IsAlreadyExists(err) {
+		return err == nil, err
+	}
+
+	return false, retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := routes.Get(context.TODO(), appname+"-route", metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		existing.Object["spec"] = route.Object["spec"]
+		_, err = routes.Update(context.TODO(), existing, metav1.UpdateOptions{})
+		return err
+	})
 }
 
 func Createnamespace(client kubernetes.Interface, appname string) error {
+	_, err := EnsureNamespace(client, appname)
+	return err
+}
+
+// EnsureNamespace creates the app namespace unless it exists and reports
+// whether it was created.
+func EnsureNamespace(client kubernetes.Interface, appname string) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -288,21 +307,16 @@ func Createnamespace(client kubernetes.Interface, appname string) error {
 	// If namespace already exists, do NOT fail
 	if err != nil {
 		if apierrors.IsAlreadyExists(err) {
-			return nil
+			return false, nil
 		}
-		return err
+		return false, err
 	}
 
-	return nil
+	return true, nil
 }
 
 func DeleteNamespace(client kubernetes.Interface, appname string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	err := client.CoreV1().
-		Namespaces().
-		Delete(ctx, appname, metav1.DeleteOptions{})
+	err := deleteNamespace(client, appname, metav1.DeleteOptions{})
 
 	if err != nil {
 		if apierrors.IsNotFound(err) {
@@ -314,6 +328,17 @@ func DeleteNamespace(client kubernetes.Interface, appname string) error {
 	return nil
 }
 
+// deleteNamespace is DeleteNamespace passing NotFound on, for the delete
+// summary.
+func deleteNamespace(client kubernetes.Interface, appname string, opts metav1.DeleteOptions) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	return client.CoreV1().
+		Namespaces().
+		Delete(ctx, appname, opts)
+}
+
 func ptrProtocol(p string) *v1.Protocol {
 	proto := v1.Protocol(p)
 	return &proto
@@ -0,0 +1,281 @@
+package create
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DeleteSummary is the outcome of deleting an app's resources. Every step
+// is attempted; a resource that was already gone counts as missing, not as
+// a failure, so running a delete again is always safe.
+type DeleteSummary struct {
+	Removed []string          `json:"removed"`
+	Missing []string          `json:"missing"`
+	Failed  map[string]string `json:"failed,omitempty"`
+}
+
+// Record files the result of removing one resource.
+func (s *DeleteSummary) Record(resource string, err error) {
+	switch {
+	case err == nil:
+		s.Removed = append(s.Removed, resource)
+	case apierrors.IsNotFound(err):
+		s.Missing = append(s.Missing, resource)
+	default:
+		if s.Failed == nil {
+			s.Failed = map[string]string{}
+		}
+		s.Failed[resource] = err.Error()
+	}
+}
+
+// Err is nil when nothing failed.
+func (s *DeleteSummary) Err() error {
+	if len(s.Failed) == 0 {
+		return nil
+	}
+	parts := make([]string, 0, len(s.Failed))
+	for resource, msg := range s.Failed {
+		parts = append(parts, resource+": "+msg)
+	}
+	sort.Strings(parts)
+	return errors.New(strings.Join(parts, "; "))
+}
+
+func (s *DeleteSummary) String() string {
+	out := fmt.Sprintf("removed [%s], already gone [%s]", strings.Join(s.Removed, ", "), strings.Join(s.Missing, ", "))
+	if err := s.Err(); err != nil {
+		out += ", failed: " + err.Error()
+	}
+	return out
+}
+
+// InstDelete removes the app right away: nothing gets a grace period, pods
+// left behind are force-deleted and a namespace stuck in Terminating has
+// its finalizers stripped. Progress is passed to report.
+func InstDelete(client kubernetes.Interface, dynclient dynamic.Interface, namespace string, appname string, report func(string)) *DeleteSummary {
+	ctx := context.Background()
+	summary := &DeleteSummary{}
+	now := metav1.DeleteOptions{GracePeriodSeconds: int64Ptr(0)}
+
+	summary.Record("route", dynclient.
+		Resource(ingressRouteRes).
+		Namespace(namespace).
+		Delete(ctx, appname+"-route", metav1.DeleteOptions{}))
+	summary.Record("hpa", deleteHPA(client, appname))
+	summary.Record("deployment", client.AppsV1().
+		Deployments(namespace).
+		Delete(ctx, appname, now))
+	summary.Record("service", client.CoreV1().
+		Services(namespace).
+		Delete(ctx, appname+"-service", metav1.DeleteOptions{}))
+
+	if n, err := forceDeletePods(client, namespace, "app="+appname); err != nil {
+		summary.Record("pods", err)
+	} else if n > 0 {
+		report(fmt.Sprintf("Force-deleted %d pod(s)", n))
+	}
+
+	err := deleteNamespace(client, appname, now)
+	if err == nil {
+		err = finalizeNamespace(client, appname, namespaceWait, report)
+	}
+	summary.Record("namespace", err)
+
+	return summary
+}
+
+// namespaceWait is how long a force delete lets a namespace terminate on
+// its own before clearing its finalizers.
+const namespaceWait = 15 * time.Second
+
+// forceDeletePods removes the pods matching selector with no grace period,
+// returning how many were deleted.
+func forceDeletePods(client kubernetes.Interface, namespace string, selector string) (int, error) {
+	pods, err := client.CoreV1().Pods(namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if apierrors.IsNotFound(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, pod := range pods.Items {
+		err := client.CoreV1().Pods(namespace).Delete(context.Background(), pod.Name, metav1.DeleteOptions{
+			GracePeriodSeconds: int64Ptr(0),
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return deleted, fmt.Errorf("pod %s: %w", pod.Name, err)
+		}
+		// one already gone was not ours to count
+		if err == nil {
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// finalizeNamespace waits up to wait for the namespace to go away and, if it
+// is still Terminating by then, empties its finalizers so the api server can
+// drop it. Anything that was holding it up is abandoned.
+func finalizeNamespace(client kubernetes.Interface, name string, wait time.Duration, report func(string)) error {
+	namespaces := client.CoreV1().Namespaces()
+	deadline := time.Now().Add(wait)
+
+	for {
+		ns, err := namespaces.Get(context.Background(), name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if time.Now().After(deadline) {
+			report(fmt.Sprintf("Namespace %s stuck in %s, clearing finalizers", name, ns.Status.Phase))
+			if len(ns.Finalizers) > 0 {
+				ns.Finalizers = nil
+				if ns, err = namespaces.Update(context.Background(), ns, metav1.UpdateOptions{}); err != nil {
+					return fmt.Errorf("clear finalizers: %w", err)
+				}
+			}
+			ns.Spec.Finalizers = nil
+			_, err = namespaces.Finalize(context.Background(), ns, metav1.UpdateOptions{})
+			if apierrors.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// DefaultDrainPeriod is how long a graceful delete keeps pods running after
+// the route is gone, DRAIN_PERIOD (a Go duration) overrides it.
+const DefaultDrainPeriod = 15 * time.Second
+
+func DrainPeriod() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("DRAIN_PERIOD")); err == nil && d >= 0 {
+		return d
+	}
+	return DefaultDrainPeriod
+}
+
+// Deletegracefully takes the app down without cutting requests short: the
+// route goes first so no new traffic arrives, in-flight requests get drain
+// to finish, then the app is scaled to zero and its pods are given their
+// termination grace period before Service, Deployment and namespace go.
+// Progress is passed to report.
+func Deletegracefully(client kubernetes.Interface, dynclient dynamic.Interface, namespace string, appname string, drain time.Duration, report func(string)) *DeleteSummary {
+	summary := &DeleteSummary{}
+
+	// each step gets stepTimeout for its api calls on top of however long it
+	// means to wait, so a hung api server can not hold the delete forever
+	ctx, cancel := context.WithTimeout(context.Background(), drain+stepTimeout)
+	summary.Record("route", dynclient.
+		Resource(ingressRouteRes).
+		Namespace(namespace).
+		Delete(ctx, appname+"-route", metav1.DeleteOptions{}))
+
+	if drain > 0 {
+		report(fmt.Sprintf("Route removed, draining traffic for %s...", drain))
+		select {
+		case <-time.After(drain):
+		case <-ctx.Done():
+		}
+	}
+	cancel()
+
+	// the HPA would scale the app straight back up
+	summary.Record("hpa", deleteHPA(client, appname))
+
+	grace := int64(120)
+	ctx, cancel = context.WithTimeout(context.Background(), stepTimeout)
+	dep, err := client.AppsV1().Deployments(namespace).Get(ctx, appname, metav1.GetOptions{})
+	cancel()
+	if err == nil && dep.Spec.Template.Spec.TerminationGracePeriodSeconds != nil {
+		grace = *dep.Spec.Template.Spec.TerminationGracePeriodSeconds
+	}
+
+	// a little slack on top of the grace period for the kubelet
+	wait := time.Duration(grace+15) * time.Second
+	ctx, cancel = context.WithTimeout(context.Background(), wait+stepTimeout)
+	_, err = client.AppsV1().
+		Deployments(namespace).
+		UpdateScale(
+			ctx,
+			appname,
+			&autoscalingv1.Scale{
+				ObjectMeta: metav1.ObjectMeta{Name: appname, Namespace: namespace},
+				Spec:       autoscalingv1.ScaleSpec{Replicas: 0},
+			},
+			metav1.UpdateOptions{},
+		)
+	switch {
+	case err == nil:
+		report(fmt.Sprintf("Scaled down, waiting up to %ds for pods to stop...", grace))
+		if err := waitForPodsGone(ctx, client, namespace, appname, wait, report); err != nil {
+			report(fmt.Sprintf("⚠️ %v, continuing with delete", err))
+		}
+	case !apierrors.IsNotFound(err):
+		summary.Record("scale-down", err)
+	}
+	cancel()
+
+	ctx, cancel = context.WithTimeout(context.Background(), stepTimeout)
+	defer cancel()
+	summary.Record("service", client.CoreV1().
+		Services(namespace).
+		Delete(ctx, appname+"-service", metav1.DeleteOptions{}))
+	summary.Record("deployment", client.AppsV1().
+		Deployments(namespace).
+		Delete(ctx, appname, metav1.DeleteOptions{}))
+	summary.Record("namespace", deleteNamespace(client, appname, metav1.DeleteOptions{}))
+
+	return summary
+}
+
+// stepTimeout bounds the api calls of one graceful delete step.
+const stepTimeout = 60 * time.Second
+
+// waitForPodsGone polls until no app pods are left, reporting the count as
+// it drops.
+func waitForPodsGone(ctx context.Context, client kubernetes.Interface, namespace string, appname string, timeout time.Duration, report func(string)) error {
+	deadline := time.Now().Add(timeout)
+	last := -1
+
+	for {
+		pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: "app=" + appname,
+		})
+		if err != nil {
+			return err
+		}
+		left := len(pods.Items)
+		if left == 0 {
+			report("All pods stopped.")
+			return nil
+		}
+		if left != last {
+			report(fmt.Sprintf("%d pod(s) still terminating", left))
+			last = left
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%d pod(s) still running after %s", left, timeout)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
@@ -0,0 +1,135 @@
+package create
+
+import (
+	"context"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// HealthCheck is the per-app probe configuration. Without a Path the probes
+// only check that the port accepts connections. Zero values fall back to
+// the defaults below, Port 0 means the app port.
+type HealthCheck struct {
+	Path             string
+	Port             int32
+	TimeoutSeconds   int32
+	FailureThreshold int32
+	StartupSeconds   int32
+}
+
+const (
+	defaultProbeTimeout     int32 = 1
+	defaultFailureThreshold int32 = 3
+	defaultStartupSeconds   int32 = 120
+
+	readinessPeriod int32 = 5
+	livenessPeriod  int32 = 10
+	startupPeriod   int32 = 5
+)
+
+func (h HealthCheck) withDefaults(port int32) HealthCheck {
+	if h.Port == 0 {
+		h.Port = port
+	}
+	if h.TimeoutSeconds <= 0 {
+		h.TimeoutSeconds = defaultProbeTimeout
+	}
+	if h.FailureThreshold <= 0 {
+		h.FailureThreshold = defaultFailureThreshold
+	}
+	if h.StartupSeconds <= 0 {
+		h.StartupSeconds = defaultStartupSeconds
+	}
+	return h
+}
+
+func (h HealthCheck) handler() corev1.ProbeHandler {
+	if h.Path != "" {
+		return corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path: h.Path,
+				Port: intstr.FromInt32(h.Port),
+			},
+		}
+	}
+	return corev1.ProbeHandler{
+		TCPSocket: &corev1.TCPSocketAction{
+			Port: intstr.FromInt32(h.Port),
+		},
+	}
+}
+
+// Probes builds readiness, liveness and startup probes for an app listening
+// on port. The startup probe holds the other two off until the app is up,
+// for at most StartupSeconds.
+func Probes(h HealthCheck, port int32) (readiness, liveness, startup *corev1.Probe) {
+	h = h.withDefaults(port)
+
+	readiness = &corev1.Probe{
+		ProbeHandler:     h.handler(),
+		PeriodSeconds:    readinessPeriod,
+		TimeoutSeconds:   h.TimeoutSeconds,
+		FailureThreshold: h.FailureThreshold,
+	}
+	liveness = &corev1.Probe{
+		ProbeHandler:     h.handler(),
+		PeriodSeconds:    livenessPeriod,
+		TimeoutSeconds:   h.TimeoutSeconds,
+		FailureThreshold: h.FailureThreshold,
+	}
+	startup = &corev1.Probe{
+		ProbeHandler:     h.handler(),
+		PeriodSeconds:    startupPeriod,
+		TimeoutSeconds:   h.TimeoutSeconds,
+		FailureThreshold: (h.StartupSeconds + startupPeriod - 1) / startupPeriod,
+	}
+	return readiness, liveness, startup
+}
+
+// SetProbes replaces the probes of the app container in dep.
+func SetProbes(dep *appv1.Deployment, h HealthCheck, port int32) {
+	for i := range dep.Spec.Template.Spec.Containers {
+		c := &dep.Spec.Template.Spec.Containers[i]
+		if c.Name == "dep" {
+			c.ReadinessProbe, c.LivenessProbe, c.StartupProbe = Probes(h, port)
+		}
+	}
+}
+
+// ApplyHealthCheck rolls the running app onto new probes. It reports false
+// when the app is not deployed, the probes are then used on next deploy.
+func ApplyHealthCheck(client kubernetes.Interface, appname string, h HealthCheck) (bool, error) {
+	deployments := client.AppsV1().Deployments(appname)
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := deployments.Get(context.Background(), appname, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		SetProbes(existing, h, appContainerPort(existing))
+		_, err = deployments.Update(context.Background(), existing, metav1.UpdateOptions{})
+		return err
+	})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func appContainerPort(dep *appv1.Deployment) int32 {
+	for _, c := range dep.Spec.Template.Spec.Containers {
+		if c.Name == "dep" && len(c.Ports) > 0 {
+			return c.Ports[0].ContainerPort
+		}
+	}
+	return DefaultPort
+}
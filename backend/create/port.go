@@ -0,0 +1,110 @@
+package create
+
+import (
+	"context"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// DefaultPort is used when neither the app settings nor its config name a
+// port. Buildpack images listen on $PORT, so most apps just follow it.
+const DefaultPort int32 = 8080
+
+// ParsePort returns 0 for anything that is not a usable TCP port.
+func ParsePort(value string) int32 {
+	port, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || port < 1 || port > 65535 {
+		return 0
+	}
+	return int32(port)
+}
+
+func portEnv(port int32) []corev1.EnvVar {
+	return []corev1.EnvVar{
+		{Name: "PORT", Value: strconv.Itoa(int(port))},
+	}
+}
+
+func servicePorts(port int32) []corev1.ServicePort {
+	return []corev1.ServicePort{
+		{
+			Port:       port,
+			TargetPort: intstr.FromInt32(port),
+		},
+	}
+}
+
+// ApplyPort moves a running app to a new port: the Deployment gets the new
+// PORT, container port and probes, then Service and route follow. It reports
+// false when the app is not deployed, the port is then used on next deploy.
+func ApplyPort(client kubernetes.Interface, dynclient dynamic.Interface, appname string, domain string, port int32) (bool, error) {
+	deployments := client.AppsV1().Deployments(appname)
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := deployments.Get(context.Background(), appname, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		old := appContainerPort(existing)
+		for i := range existing.Spec.Template.Spec.Containers {
+			c := &existing.Spec.Template.Spec.Containers[i]
+			if c.Name != "dep" {
+				continue
+			}
+			c.Env = setPortEnv(c.Env, port)
+			c.Ports = []corev1.ContainerPort{{ContainerPort: port}}
+			for _, probe := range []*corev1.Probe{c.ReadinessProbe, c.LivenessProbe, c.StartupProbe} {
+				retargetProbe(probe, old, port)
+			}
+		}
+
+		_, err = deployments.Update(context.Background(), existing, metav1.UpdateOptions{})
+		return err
+	})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := CreateService(client, appname, appname, port); err != nil {
+		return true, err
+	}
+	if _, err := CreateRoute(dynclient, appname, domain, appname, port); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// retargetProbe moves a probe that checks the old app port to the new one,
+// probes on a dedicated health port are left alone.
+func retargetProbe(probe *corev1.Probe, old int32, port int32) {
+	if probe == nil {
+		return
+	}
+	if probe.TCPSocket != nil && probe.TCPSocket.Port.IntVal == old {
+		probe.TCPSocket.Port = intstr.FromInt32(port)
+	}
+	if probe.HTTPGet != nil && probe.HTTPGet.Port.IntVal == old {
+		probe.HTTPGet.Port = intstr.FromInt32(port)
+	}
+}
+
+func setPortEnv(env []corev1.EnvVar, port int32) []corev1.EnvVar {
+	for i := range env {
+		if env[i].Name == "PORT" {
+			env[i].Value = strconv.Itoa(int(port))
+			return env
+		}
+	}
+	return append(env, portEnv(port)...)
+}
@@ -0,0 +1,65 @@
+package create
+
+import (
+	"context"
+
+	appv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// RevertTo puts the app Deployment back on the pod template deployment depid
+// ran with, taken from its ReplicaSet like kubectl rollout undo does, so port,
+// probes and resources go back too. Config and secrets are not rolled back,
+// so the template keeps the current config hash and secrets version. When
+// that ReplicaSet was already pruned only the image is reverted.
+func RevertTo(client kubernetes.Interface, appname string, depid string, image string) (*appv1.Deployment, error) {
+	sets, err := client.AppsV1().ReplicaSets(appname).List(context.Background(), metav1.ListOptions{
+		LabelSelector: "app=" + appname,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var previous *appv1.ReplicaSet
+	for i := range sets.Items {
+		if sets.Items[i].Spec.Template.Annotations[DepIDAnnotation] == depid {
+			previous = &sets.Items[i]
+			break
+		}
+	}
+	if previous == nil {
+		return SetImage(client, appname, image, depid)
+	}
+
+	template := previous.Spec.Template.DeepCopy()
+	delete(template.Labels, appv1.DefaultDeploymentUniqueLabelKey)
+
+	deployments := client.AppsV1().Deployments(appname)
+	var result *appv1.Deployment
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := deployments.Get(context.Background(), appname, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		reverted := template.DeepCopy()
+		if reverted.Annotations == nil {
+			reverted.Annotations = map[string]string{}
+		}
+		for _, key := range []string{ConfigHashAnnotation, SecretsVersionAnnotation} {
+			if value, ok := existing.Spec.Template.Annotations[key]; ok {
+				reverted.Annotations[key] = value
+			} else {
+				delete(reverted.Annotations, key)
+			}
+		}
+		existing.Spec.Template = *reverted
+		result, err = deployments.Update(context.Background(), existing, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
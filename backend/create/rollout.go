@@ -0,0 +1,158 @@
+package create
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DefaultRolloutTimeout bounds how long the pipeline waits for a rollout
+// to become available, ROLLOUT_TIMEOUT (a Go duration) overrides it.
+const DefaultRolloutTimeout = 5 * time.Minute
+
+// RolloutTimeout returns the configured rollout deadline.
+func RolloutTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("ROLLOUT_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return DefaultRolloutTimeout
+}
+
+// container waiting reasons that will not fix themselves
+var fatalWaitReasons = map[string]bool{
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+// WatchRollout follows the rollout of deployment depid of the app until all
+// replicas are updated and available. Progress is passed to report as it
+// changes. It fails early when a new pod hits an unrecoverable state such
+// as ImagePullBackOff, CrashLoopBackOff or OOMKilled, when Kubernetes gives
+// up on the rollout, or once timeout has passed.
+func WatchRollout(client kubernetes.Interface, appname string, depid string, timeout time.Duration, report func(string)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	last := ""
+	for {
+		dep, err := client.AppsV1().Deployments(appname).Get(ctx, appname, metav1.GetOptions{})
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("rollout not available after %s", timeout)
+			}
+			return err
+		}
+		if rolloutComplete(dep) {
+			return nil
+		}
+
+		if cond := deploymentCondition(dep, appv1.DeploymentProgressing); cond != nil && cond.Reason == "ProgressDeadlineExceeded" {
+			return fmt.Errorf("rollout stalled: %s", cond.Message)
+		}
+
+		problem, err := podProblem(ctx, client, appname, depid)
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+		if problem != "" {
+			return errors.New(problem)
+		}
+
+		progress := fmt.Sprintf("%d/%d replicas updated, %d available",
+			dep.Status.UpdatedReplicas, replicasOf(dep), dep.Status.AvailableReplicas)
+		if progress != last {
+			report(progress)
+			last = progress
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("rollout not available after %s (%s)", timeout, progress)
+		case <-time.After(3 * time.Second):
+		}
+	}
+}
+
+func replicasOf(dep *appv1.Deployment) int32 {
+	if dep.Spec.Replicas == nil {
+		return 1
+	}
+	return *dep.Spec.Replicas
+}
+
+func rolloutComplete(dep *appv1.Deployment) bool {
+	if dep.Status.ObservedGeneration < dep.Generation {
+		return false
+	}
+	want := replicasOf(dep)
+	if dep.Status.UpdatedReplicas < want || dep.Status.AvailableReplicas < want {
+		return false
+	}
+	// old replicas still around
+	if dep.Status.Replicas > dep.Status.UpdatedReplicas {
+		return false
+	}
+	cond := deploymentCondition(dep, appv1.DeploymentAvailable)
+	return cond != nil && cond.Status == corev1.ConditionTrue
+}
+
+func deploymentCondition(dep *appv1.Deployment, condType appv1.DeploymentConditionType) *appv1.DeploymentCondition {
+	for i := range dep.Status.Conditions {
+		if dep.Status.Conditions[i].Type == condType {
+			return &dep.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// podProblem looks at the pods of deployment depid and describes the first
+// one that is failing for good, "" while they are still on their way.
+func podProblem(ctx context.Context, client kubernetes.Interface, appname string, depid string) (string, error) {
+	pods, err := client.CoreV1().Pods(appname).List(ctx, metav1.ListOptions{
+		LabelSelector: "app=" + appname,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	for _, pod := range pods.Items {
+		if pod.Annotations[DepIDAnnotation] != depid {
+			continue
+		}
+		for _, cs := range pod.Status.ContainerStatuses {
+			if w := cs.State.Waiting; w != nil {
+				if fatalWaitReasons[w.Reason] {
+					return fmt.Sprintf("pod %s: %s: %s", pod.Name, w.Reason, w.Message), nil
+				}
+				if w.Reason == "CrashLoopBackOff" {
+					return fmt.Sprintf("pod %s: CrashLoopBackOff%s", pod.Name, lastExit(cs)), nil
+				}
+			}
+			if t := cs.LastTerminationState.Terminated; t != nil && t.Reason == "OOMKilled" {
+				return fmt.Sprintf("pod %s: OOMKilled, the app needs more memory", pod.Name), nil
+			}
+		}
+		if pod.Status.Phase == corev1.PodFailed {
+			return fmt.Sprintf("pod %s failed: %s", pod.Name, pod.Status.Reason), nil
+		}
+	}
+	return "", nil
+}
+
+func lastExit(cs corev1.ContainerStatus) string {
+	t := cs.LastTerminationState.Terminated
+	if t == nil {
+		return ""
+	}
+	return fmt.Sprintf(" (last exit code %d, %s)", t.ExitCode, t.Reason)
+}
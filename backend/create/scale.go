@@ -0,0 +1,109 @@
+package create
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// DefaultReplicas is what a first deploy starts with unless the app was
+// scaled through the api.
+const DefaultReplicas int32 = 2
+
+// DefaultCPU and DefaultMemory are the limits of an app never resized.
+const (
+	DefaultCPU    = "500m"
+	DefaultMemory = "500Mi"
+)
+
+// ParseReplicas returns -1 for anything that is not a replica count.
+func ParseReplicas(value string) int32 {
+	n, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || n < 0 {
+		return -1
+	}
+	return int32(n)
+}
+
+// Resources builds the container resources for a cpu and memory limit as
+// picked from the size tiers. Requests are a quarter of the cpu and half of
+// the memory limit, which keeps the old 125m/500m ratio for cpu.
+func Resources(cpu string, memory string) (corev1.ResourceRequirements, error) {
+	cpuLimit, err := resource.ParseQuantity(cpu)
+	if err != nil {
+		return corev1.ResourceRequirements{}, fmt.Errorf("invalid cpu %q: %w", cpu, err)
+	}
+	memLimit, err := resource.ParseQuantity(memory)
+	if err != nil {
+		return corev1.ResourceRequirements{}, fmt.Errorf("invalid memory %q: %w", memory, err)
+	}
+
+	return corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    *resource.NewMilliQuantity(cpuLimit.MilliValue()/4, resource.DecimalSI),
+			corev1.ResourceMemory: *resource.NewQuantity(memLimit.Value()/2, resource.BinarySI),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    cpuLimit,
+			corev1.ResourceMemory: memLimit,
+		},
+	}, nil
+}
+
+// SetResources replaces the resources of the app container in dep.
+func SetResources(dep *appv1.Deployment, res corev1.ResourceRequirements) {
+	for i := range dep.Spec.Template.Spec.Containers {
+		if dep.Spec.Template.Spec.Containers[i].Name == "dep" {
+			dep.Spec.Template.Spec.Containers[i].Resources = res
+		}
+	}
+}
+
+// ScaleApp sets the replica count of the running app. It reports false
+// when the app is not deployed, the count is then used on first deploy.
+func ScaleApp(client kubernetes.Interface, appname string, replicas int32) (bool, error) {
+	patch := fmt.Sprintf(`{"spec":{"replicas":%d}}`, replicas)
+
+	_, err := client.AppsV1().
+		Deployments(appname).
+		Patch(context.Background(), appname, types.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ResizeApp rolls the running app onto new resources. It reports false when
+// the app is not deployed, the size is then used on next deploy.
+func ResizeApp(client kubernetes.Interface, appname string, res corev1.ResourceRequirements) (bool, error) {
+	deployments := client.AppsV1().Deployments(appname)
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := deployments.Get(context.Background(), appname, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		SetResources(existing, res)
+		_, err = deployments.Update(context.Background(), existing, metav1.UpdateOptions{})
+		return err
+	})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,97 @@
+package create
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// SecretsVersionAnnotation carries the resourceVersion of <app>-secrets on
+// the pod template. Unlike config, a hash of the values is never written
+// anywhere readable.
+const SecretsVersionAnnotation = "forgepaas.io/secrets-version"
+
+func SecretName(appname string) string {
+	return appname + "-secrets"
+}
+
+// SetSecrets merges values into the <app>-secrets Secret in the app
+// namespace and returns its new resourceVersion.
+func SetSecrets(client kubernetes.Interface, appname string, values map[string]string) (string, error) {
+	return updateSecrets(client, appname, func(data map[string][]byte) {
+		for k, v := range values {
+			data[k] = []byte(v)
+		}
+	})
+}
+
+// UnsetSecrets removes keys from <app>-secrets and returns its new resourceVersion.
+func UnsetSecrets(client kubernetes.Interface, appname string, keys []string) (string, error) {
+	return updateSecrets(client, appname, func(data map[string][]byte) {
+		for _, k := range keys {
+			delete(data, k)
+		}
+	})
+}
+
+func updateSecrets(client kubernetes.Interface, appname string, change func(map[string][]byte)) (string, error) {
+	if err := Createnamespace(client, appname); err != nil {
+		return "", err
+	}
+
+	secrets := client.CoreV1().Secrets(appname)
+	var version string
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := secrets.Get(context.Background(), SecretName(appname), metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			secret = &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      SecretName(appname),
+					Namespace: appname,
+				},
+				Type: corev1.SecretTypeOpaque,
+				Data: map[string][]byte{},
+			}
+			change(secret.Data)
+			created, err := secrets.Create(context.Background(), secret, metav1.CreateOptions{})
+			if err != nil {
+				return err
+			}
+			version = created.ResourceVersion
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		change(secret.Data)
+		updated, err := secrets.Update(context.Background(), secret, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		version = updated.ResourceVersion
+		return nil
+	})
+	return version, err
+}
+
+// SecretsVersion returns the resourceVersion of <app>-secrets, or "" when the
+// app has no secrets.
+func SecretsVersion(client kubernetes.Interface, appname string) (string, error) {
+	secret, err := client.CoreV1().Secrets(appname).Get(context.Background(), SecretName(appname), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return secret.ResourceVersion, nil
+}
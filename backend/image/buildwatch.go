@@ -0,0 +1,147 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DefaultBuildTimeout bounds a whole build job, retries included,
+// BUILD_TIMEOUT (a Go duration) overrides it.
+const DefaultBuildTimeout = 15 * time.Minute
+
+// BuildTimeout returns the configured build deadline.
+func BuildTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("BUILD_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return DefaultBuildTimeout
+}
+
+// ErrBuildJobRemoved is returned by WatchBuild when the job disappears
+// before finishing, for instance when a force delete cancels it.
+var ErrBuildJobRemoved = errors.New("build job removed")
+
+// how many lines of the failing container's log end up in a BuildError
+const buildLogTail int64 = 20
+
+// BuildError describes a build job Kubernetes gave up on.
+type BuildError struct {
+	Reason    string
+	Message   string
+	Container string
+	ExitCode  int32
+	Logs      []string
+}
+
+func (e *BuildError) Error() string {
+	out := "build failed"
+	if e.Reason != "" {
+		out += " (" + e.Reason + ")"
+	}
+	if e.Container != "" {
+		out += fmt.Sprintf(": step %s exited with code %d", e.Container, e.ExitCode)
+	} else if e.Message != "" {
+		out += ": " + e.Message
+	}
+	return out
+}
+
+// WatchBuild follows build job jobname until it completes or fails for good,
+// which is once its retries are used up or its deadline has passed. A failed
+// attempt that will be retried is passed to report. It returns nil when the
+// job completed and a *BuildError when it failed; ctx ending stops it early
+// with ctx.Err(). Errors reading the job are retried until then.
+func WatchBuild(ctx context.Context, client kubernetes.Interface, jobname string, namespace string, report func(string)) error {
+	var failed int32
+
+	for {
+		job, err := client.BatchV1().Jobs(namespace).Get(ctx, jobname, metav1.GetOptions{})
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case apierrors.IsNotFound(err):
+			return ErrBuildJobRemoved
+		case err != nil:
+			log.Printf("watching build job %s: %v, retrying", jobname, err)
+		default:
+			if jobCondition(job, batchv1.JobComplete) != nil {
+				return nil
+			}
+			if cond := jobCondition(job, batchv1.JobFailed); cond != nil {
+				buildErr := &BuildError{Reason: cond.Reason, Message: cond.Message}
+				failedStep(ctx, client, jobname, namespace, buildErr)
+				return buildErr
+			}
+
+			if job.Status.Failed > failed {
+				failed = job.Status.Failed
+				report(fmt.Sprintf("Build attempt %d failed, retrying...", failed))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(3 * time.Second):
+		}
+	}
+}
+
+func jobCondition(job *batchv1.Job, condType batchv1.JobConditionType) *batchv1.JobCondition {
+	for i := range job.Status.Conditions {
+		c := job.Status.Conditions[i]
+		if c.Type == condType && c.Status == corev1.ConditionTrue {
+			return &job.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// failedStep fills in the container that broke the newest build pod, its
+// exit code and the tail of its log. Best effort: the pods may be gone.
+func failedStep(ctx context.Context, client kubernetes.Interface, jobname string, namespace string, buildErr *BuildError) {
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("job-name=%s", jobname),
+	})
+	if err != nil || len(pods.Items) == 0 {
+		return
+	}
+
+	latest := pods.Items[0]
+	for _, pod := range pods.Items[1:] {
+		if pod.CreationTimestamp.After(latest.CreationTimestamp.Time) {
+			latest = pod
+		}
+	}
+
+	statuses := append(latest.Status.InitContainerStatuses, latest.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		t := cs.State.Terminated
+		if t == nil || t.ExitCode == 0 {
+			continue
+		}
+		buildErr.Container = cs.Name
+		buildErr.ExitCode = t.ExitCode
+
+		tail := buildLogTail
+		raw, err := client.CoreV1().Pods(namespace).GetLogs(latest.Name, &corev1.PodLogOptions{
+			Container: cs.Name,
+			TailLines: &tail,
+		}).DoRaw(ctx)
+		if err == nil {
+			buildErr.Logs = strings.Split(strings.TrimRight(string(raw), "\n"), "\n")
+		}
+		return
+	}
+}
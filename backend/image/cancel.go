@@ -0,0 +1,78 @@
+package image
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// build jobs and their pods carry the app and deployment they build, so they
+// can be found again to cancel
+func buildLabels(appname string, depid string) map[string]string {
+	return map[string]string{
+		"app":   appname,
+		"depid": depid,
+	}
+}
+
+// BuildJobName is the name of the build job of deployment depid.
+func BuildJobName(appname string, depid string) string {
+	return "build-" + appname + depid
+}
+
+// CancelBuild deletes one build job, waiting on the api server side for its
+// pods to go first. An already finished or removed job is not an error.
+func CancelBuild(client kubernetes.Interface, appname string, depid string) error {
+	foreground := metav1.DeletePropagationForeground
+	err := client.BatchV1().Jobs("builder").Delete(context.Background(), BuildJobName(appname, depid), metav1.DeleteOptions{
+		PropagationPolicy: &foreground,
+	})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// CancelBuilds removes every build job of the app in the builder namespace
+// and force-deletes its pods. It returns how many jobs were cancelled.
+func CancelBuilds(client kubernetes.Interface, appname string) (int, error) {
+	ctx := context.Background()
+	selector := metav1.ListOptions{LabelSelector: "app=" + appname}
+
+	jobs, err := client.BatchV1().Jobs("builder").List(ctx, selector)
+	if err != nil {
+		return 0, err
+	}
+
+	cancelled := 0
+	background := metav1.DeletePropagationBackground
+	for _, job := range jobs.Items {
+		err := client.BatchV1().Jobs("builder").Delete(ctx, job.Name, metav1.DeleteOptions{
+			PropagationPolicy: &background,
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return cancelled, fmt.Errorf("job %s: %w", job.Name, err)
+		}
+		// one already gone was not ours to count
+		if err == nil {
+			cancelled++
+		}
+	}
+
+	// the job controller would let the pods finish their grace period
+	pods, err := client.CoreV1().Pods("builder").List(ctx, selector)
+	if err != nil {
+		return cancelled, err
+	}
+	zero := int64(0)
+	for _, pod := range pods.Items {
+		err := client.CoreV1().Pods("builder").Delete(ctx, pod.Name, metav1.DeleteOptions{GracePeriodSeconds: &zero})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return cancelled, fmt.Errorf("pod %s: %w", pod.Name, err)
+		}
+	}
+	return cancelled, nil
+}
@@ -0,0 +1,105 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// how long the clone that settles an auto build mode may take
+const detectTimeout int64 = 300
+
+// DetectJobName is the name of the job settling the build mode of
+// deployment depid.
+func DetectJobName(appname string, depid string) string {
+	return "detect-" + appname + depid
+}
+
+// ResolveBuildMode settles an auto (or empty) build mode before the build
+// job is made, so the job only pulls the builder it needs. It runs the clone
+// step on its own in a short job that reports the mode it picked through its
+// termination message. Explicit modes come back as they are. Failures of the
+// clone come back as a *BuildError.
+func ResolveBuildMode(ctx context.Context, client kubernetes.Interface, giturl string, ref string, appname string, depid string, buildMode string) (string, error) {
+	if buildMode == "buildpacks" || buildMode == "dockerfile" {
+		return buildMode, nil
+	}
+
+	job := detectJob(giturl, ref, appname, depid)
+	if _, err := MountGitAuth(client, job, appname); err != nil {
+		return "", err
+	}
+	if _, err := JobRunner(client, job); err != nil {
+		return "", err
+	}
+	defer func() {
+		background := metav1.DeletePropagationBackground
+		client.BatchV1().Jobs(job.Namespace).Delete(context.Background(), job.Name, metav1.DeleteOptions{
+			PropagationPolicy: &background,
+		})
+	}()
+
+	if err := WatchBuild(ctx, client, job.Name, job.Namespace, func(string) {}); err != nil {
+		return "", err
+	}
+
+	pods, err := client.CoreV1().Pods(job.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("job-name=%s", job.Name),
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, pod := range pods.Items {
+		for _, cs := range pod.Status.ContainerStatuses {
+			if t := cs.State.Terminated; cs.Name == "mode" && t != nil && t.ExitCode == 0 {
+				mode := strings.TrimSpace(t.Message)
+				if mode != "buildpacks" && mode != "dockerfile" {
+					return "", fmt.Errorf("clone reported unknown build mode %q", mode)
+				}
+				return mode, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("clone did not report a build mode")
+}
+
+// detectJob clones the repo like the build job does and hands the mode the
+// clone step picked to the api server as its termination message.
+func detectJob(giturl string, ref string, appname string, depid string) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      DetectJobName(appname, depid),
+			Namespace: "builder",
+			Labels:    buildLabels(appname, depid),
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          int32Ptr(0),
+			ActiveDeadlineSeconds: int64Ptr(detectTimeout),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: buildLabels(appname, depid),
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Volumes:       buildVolumes(),
+					InitContainers: []corev1.Container{
+						pullrepoContainer(giturl, ref, "auto"),
+					},
+					Containers: []corev1.Container{
+						{
+							Name:         "mode",
+							Image:        "alpine/git",
+							Command:      []string{"sh", "-c", "cat /meta/mode > /dev/termination-log"},
+							VolumeMounts: metaMounts(),
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -24,6 +24,10 @@ func int32Ptr(i int32) *int32 {
 	return &i
 }
 
+func int64Ptr(i int64) *int64 {
+	return &i
+}
+
 func CreateClient(kubeconfigPath string) (kubernetes.Interface, error) {
 	var kubeconfig *rest.Config
 
@@ -87,8 +91,11 @@ func JobRunner(client kubernetes.Interface, job *batchv1.Job) (*batchv1.Job, err
 
 }
 
-func LogsGiver(client kubernetes.Interface, jobname string, namespace string, rds *redis.Client, appname string) {
-	ctx := context.Background()
+// LogsGiver streams every build container to logs:<appname>. onStage, when
+// set, is called with the container name as each step starts and with
+// "export" once the image starts being exported to the registry. It gives up
+// once ctx ends.
+func LogsGiver(ctx context.Context, client kubernetes.Interface, jobname string, namespace string, rds *redis.Client, appname string, onStage func(string)) {
 	channelName := "logs:" + appname
 
 	publish := func(msg string) {
@@ -100,7 +107,12 @@ func LogsGiver(client kubernetes.Interface, jobname string, namespace string, rd
 	publish(fmt.Sprintf("[SYSTEM] Waiting for build pod for job: %s...", jobname))
 
 	var podName string
+	// the steps differ by build mode, follow the ones the pod has
+	var containers []string
 	for {
+		if ctx.Err() != nil {
+			return
+		}
 		pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
 			LabelSelector: fmt.Sprintf("job-name=%s", jobname),
 		})
@@ -115,6 +127,9 @@ func LogsGiver(client kubernetes.Interface, jobname string, namespace string, rd
 
 			if pod.Status.Phase != corev1.PodUnknown {
 				podName = pod.Name
+				for _, c := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+					containers = append(containers, c.Name)
+				}
 				break
 			}
 		}
@@ -123,11 +138,12 @@ func LogsGiver(client kubernetes.Interface, jobname string, namespace string, rd
 
 	publish(fmt.Sprintf("[SYSTEM] Found Pod: %s. preparing log stream...", podName))
 
-	containers := []string{"pullrepo", "cnd-binary", "notifier"}
-
 	for _, containerName := range containers {
 
 		for {
+			if ctx.Err() != nil {
+				return
+			}
 			pod, err := client.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
 			if err != nil {
 				time.Sleep(1 * time.Second)
@@ -176,6 +192,9 @@ func LogsGiver(client kubernetes.Interface, jobname string, namespace string, rd
 		}
 
 		publish(fmt.Sprintf("[SYSTEM] --- Starting Step: %s ---", containerName))
+		if onStage != nil {
+			onStage(containerName)
+		}
 
 		req := client.CoreV1().Pods(namespace).GetLogs(podName, &corev1.PodLogOptions{
 			Container: containerName,
@@ -194,6 +213,9 @@ func LogsGiver(client kubernetes.Interface, jobname string, namespace string, rd
 
 		for scanner.Scan() {
 			logLine := scanner.Text()
+			if onStage != nil && (strings.Contains(logLine, "===> EXPORTING") || strings.Contains(logLine, "Pushing image to")) {
+				onStage("export")
+			}
 			formattedLog := fmt.Sprintf("[%s] %s", strings.ToUpper(containerName), logLine)
 			rds.Publish(ctx, channelName, formattedLog)
 		}
@@ -203,92 +225,239 @@ func LogsGiver(client kubernetes.Interface, jobname string, namespace string, rd
 	publish("[SYSTEM] Build Job Logs Finished.")
 }
 
-func JobObject(giturl string, appname string, depid string, registry_url string) (*batchv1.Job, string) {
+// cloneScript checks out GIT_REF (branch, tag or commit) of GIT_URL into
+// /workspace, shallow when the server allows it, and writes the resolved
+// commit to /meta/commit for the notifier. It then settles BUILD_MODE, auto
+// meaning dockerfile when the repo has one, in /meta/mode for the build
+// steps. Credentials mounted at /git-auth by MountGitAuth are used for
+// private repos without ever being printed.
+const cloneScript = `set -e
+if [ -f /git-auth/ssh-privatekey ]; then
+  mkdir -p "$HOME/.ssh"
+  cp /git-auth/ssh-privatekey "$HOME/.ssh/deploy_key"
+  chmod 600 "$HOME/.ssh/deploy_key"
+  HOSTS="-o StrictHostKeyChecking=accept-new"
+  if [ -f /git-auth/known_hosts ]; then
+    HOSTS="-o UserKnownHostsFile=/git-auth/known_hosts"
+  fi
+  export GIT_SSH_COMMAND="ssh -i $HOME/.ssh/deploy_key -o IdentitiesOnly=yes $HOSTS"
+fi
+if [ -f /git-auth/password ]; then
+  git config --global credential.helper '!f() { echo "username=$(cat /git-auth/username)"; echo "password=$(cat /git-auth/password)"; }; f'
+fi
+if [ -z "$GIT_REF" ]; then
+  git clone --depth 1 "$GIT_URL" /workspace
+else
+  git init -q /workspace
+  cd /workspace
+  git remote add origin "$GIT_URL"
+  if git fetch --depth 1 origin "$GIT_REF"; then
+    git checkout -q FETCH_HEAD
+  else
+    echo "shallow fetch of $GIT_REF failed, fetching full history"
+    git fetch --tags origin '+refs/heads/*:refs/remotes/origin/*'
+    git checkout -q "$GIT_REF"
+  fi
+fi
+git -C /workspace rev-parse HEAD > /meta/commit
+echo "Resolved commit $(cat /meta/commit)"
+MODE="$BUILD_MODE"
+if [ -z "$MODE" ] || [ "$MODE" = "auto" ]; then
+  if [ -f /workspace/Dockerfile ]; then
+    MODE=dockerfile
+  else
+    MODE=buildpacks
+  fi
+fi
+if [ "$MODE" = "dockerfile" ] && [ ! -f /workspace/Dockerfile ]; then
+  echo "Dockerfile build requested but the repo has no Dockerfile"
+  exit 1
+fi
+echo "$MODE" > /meta/mode
+echo "Build mode: $MODE"`
+
+// buildScript runs the CNB lifecycle on /workspace and leaves what the
+// notifier reports in /meta: start and finish time, exit code, the lifecycle
+// report with the image digest and the buildpack group that ran. It always
+// exits 0 so the notifier gets to report a failed build too.
+const buildScript = `date +%s > /meta/started_at
+/cnb/lifecycle/creator \
+  -app=/workspace \
+  -cache-image="$CACHE_IMAGE" \
+  -run-image="$RUN_IMAGE" \
+  -skip-restore=false \
+  -report=/meta/report.toml \
+  "$APP_IMAGE" 2>&1
+echo $? > /meta/exit_code
+date +%s > /meta/finished_at
+cp /layers/group.toml /meta/group.toml 2>/dev/null
+exit 0`
+
+// dockerfileScript builds /workspace/Dockerfile with kaniko, no docker
+// daemon needed, and leaves the same /meta files as buildScript with the
+// pushed digest in /meta/digest. REGISTRY is the plain http registry the
+// image and its cache go to. The exit code only uses shell builtins, the
+// timestamps are best effort.
+const dockerfileScript = `date +%s > /meta/started_at 2>/dev/null
+/kaniko/executor \
+  --context=dir:///workspace \
+  --dockerfile=/workspace/Dockerfile \
+  --destination="$APP_IMAGE" \
+  --cache=true \
+  --cache-repo="$CACHE_REPO" \
+  --insecure-registry="$REGISTRY" \
+  --skip-tls-verify-registry="$REGISTRY" \
+  --digest-file=/meta/digest 2>&1
+EXIT_CODE=$?
+echo "$EXIT_CODE" > /meta/exit_code
+date +%s > /meta/finished_at 2>/dev/null
+exit 0`
+
+// notifyScript pushes the build signal for DEPID to status:<depid>, see
+// models.BuildSignal, then exits with the build's exit code so a failed
+// build also fails the job.
+const notifyScript = `EXIT_CODE=$(cat /meta/exit_code 2>/dev/null || echo 1)
+MODE=$(cat /meta/mode 2>/dev/null || echo buildpacks)
+STATUS=ready
+if [ "$EXIT_CODE" != "0" ]; then
+  STATUS=failed
+fi
+DIGEST=""
+if [ -f /meta/digest ]; then
+  DIGEST=$(cat /meta/digest)
+elif [ -f /meta/report.toml ]; then
+  DIGEST=$(grep -m1 '^ *digest *=' /meta/report.toml | cut -d'"' -f2)
+fi
+BUILDPACKS=""
+if [ -f /meta/group.toml ]; then
+  BUILDPACKS=$(awk -F'"' '/^ *id *=/ {id=$2} /^ *version *=/ {printf "%s\"%s@%s\"", sep, id, $2; sep=","}' /meta/group.toml)
+fi
+FINISHED=$(cat /meta/finished_at 2>/dev/null)
+[ -n "$FINISHED" ] || FINISHED=$(date +%s)
+STARTED=$(cat /meta/started_at 2>/dev/null)
+[ -n "$STARTED" ] || STARTED=$FINISHED
+PAYLOAD=$(printf '{"depid":"%s","app":"%s","status":"%s","mode":"%s","exit_code":%s,"commit":"%s","digest":"%s","buildpacks":[%s],"started_at":%s,"finished_at":%s,"duration":%s,"timestamp":%s}' \
+  "$DEPID" "$APP" "$STATUS" "$MODE" "$EXIT_CODE" "$(cat /meta/commit 2>/dev/null)" "$DIGEST" "$BUILDPACKS" \
+  "$STARTED" "$FINISHED" "$((FINISHED - STARTED))" "$(date +%s)")
+redis-cli -h "$REDIS_HOST" RPUSH "status:$DEPID" "$PAYLOAD"
+exit "$EXIT_CODE"`
+
+// metaMounts gives a build step the cloned repo and the /meta files the
+// steps pass along.
+func metaMounts() []v1.VolumeMount {
+	return []v1.VolumeMount{
+		{
+			Name:      "workspace",
+			MountPath: "/workspace",
+		},
+		{
+			Name:      "meta",
+			MountPath: "/meta",
+		},
+	}
+}
+
+// buildVolumes backs metaMounts.
+func buildVolumes() []v1.Volume {
+	return []v1.Volume{
+		{
+			Name: "workspace",
+			VolumeSource: v1.VolumeSource{
+				EmptyDir: &v1.EmptyDirVolumeSource{},
+			},
+		},
+		{
+			Name: "meta",
+			VolumeSource: v1.VolumeSource{
+				EmptyDir: &v1.EmptyDirVolumeSource{},
+			},
+		},
+	}
+}
+
+func pullrepoContainer(giturl string, ref string, buildMode string) v1.Container {
+	return v1.Container{
+		Name:  "pullrepo",
+		Image: "alpine/git",
+		Env: []corev1.EnvVar{
+			{Name: "GIT_URL", Value: giturl},
+			{Name: "GIT_REF", Value: ref},
+			{Name: "BUILD_MODE", Value: buildMode},
+		},
+		Command:      []string{"sh", "-c", cloneScript},
+		VolumeMounts: metaMounts(),
+	}
+}
+
+// JobObject builds the job that clones the repo at ref and builds it with
+// buildpacks or its Dockerfile into <registry>/<app>:<depid>. buildMode must
+// already be resolved, see ResolveBuildMode; only that mode's builder is
+// added to the job.
+func JobObject(giturl string, ref string, appname string, depid string, buildMode string, registry_url string) (*batchv1.Job, string) {
 	apptag := fmt.Sprintf("%s/%s:%s", registry_url, appname, depid)
 	image := fmt.Sprintf("%s:%s", appname, depid)
 	cacheTag := fmt.Sprintf("%s/%s:cache", registry_url, appname)
 	runImage := "paketobuildpacks/run-jammy-base:latest"
-
-	cnbCmd := fmt.Sprintf(
-		"/cnb/lifecycle/creator "+
-			"-app=/workspace "+
-			"-cache-image=%s "+
-			"-run-image=%s "+
-			"-skip-restore=false "+
-			"%s "+
-			"2>&1",
-		cacheTag, runImage, apptag,
-	)
-
-	log.Println(cnbCmd)
-
-	var payload = fmt.Sprintf(
-		`{"status":"ready","app":"%s","timestamp":%d}`,
-		appname,
-		time.Now().Unix())
+	kanikoCache := fmt.Sprintf("%s/%s-cache", registry_url, appname)
+
+	builder := v1.Container{
+		Name:            "cnd-binary",
+		Image:           "paketobuildpacks/builder-jammy-base:latest",
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Env: []corev1.EnvVar{
+			{Name: "CNB_PLATFORM_API", Value: "0.11"},
+			{Name: "APP_IMAGE", Value: apptag},
+			{Name: "CACHE_IMAGE", Value: cacheTag},
+			{Name: "RUN_IMAGE", Value: runImage},
+		},
+		Command:      []string{"/bin/sh", "-c", buildScript},
+		VolumeMounts: metaMounts(),
+	}
+	if buildMode == "dockerfile" {
+		builder = v1.Container{
+			Name:  "kaniko",
+			Image: "gcr.io/kaniko-project/executor:debug",
+			Env: []corev1.EnvVar{
+				{Name: "APP_IMAGE", Value: apptag},
+				{Name: "CACHE_REPO", Value: kanikoCache},
+				{Name: "REGISTRY", Value: registry_url},
+			},
+			Command:      []string{"/busybox/sh", "-c", dockerfileScript},
+			VolumeMounts: metaMounts(),
+		}
+	}
 
 	job := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "build-" + appname + depid,
+			Name:      BuildJobName(appname, depid),
 			Namespace: "builder",
+			Labels:    buildLabels(appname, depid),
 		},
 		Spec: batchv1.JobSpec{
-			BackoffLimit: int32Ptr(2),
+			BackoffLimit:          int32Ptr(2),
+			ActiveDeadlineSeconds: int64Ptr(int64(BuildTimeout().Seconds())),
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{"app": "demo"},
+					Labels: buildLabels(appname, depid),
 				},
 				Spec: corev1.PodSpec{
 					RestartPolicy: corev1.RestartPolicyNever,
-					Volumes: []v1.Volume{
-						{
-							Name: "workspace",
-							VolumeSource: v1.VolumeSource{
-								EmptyDir: &v1.EmptyDirVolumeSource{},
-							},
-						},
-					},
+					Volumes:       buildVolumes(),
 					InitContainers: []v1.Container{
-						{
-							Name:    "pullrepo",
-							Image:   "alpine/git",
-							Command: []string{"sh", "-c", "git clone " + giturl + " /workspace"},
-							VolumeMounts: []v1.VolumeMount{
-								{
-									Name:      "workspace",
-									MountPath: "/workspace",
-								},
-							},
-						},
-						{
-							Name:            "cnd-binary",
-							Image:           "paketobuildpacks/builder-jammy-base:latest",
-							ImagePullPolicy: corev1.PullIfNotPresent,
-							Env: []corev1.EnvVar{
-								{Name: "CNB_PLATFORM_API", Value: "0.11"},
-							},
-							Command: []string{"/bin/sh", "-c", cnbCmd},
-
-							VolumeMounts: []corev1.VolumeMount{
-								{
-									Name:      "workspace",
-									MountPath: "/workspace",
-								},
-							},
-						},
+						pullrepoContainer(giturl, ref, buildMode),
+						builder,
 					},
 					Containers: []corev1.Container{
 						{
-							Name:    "notifier",
-							Image:   "redis:alpine",
-							Command: []string{"redis-cli", "-h", "redis.default.svc.cluster.local", "RPUSH", fmt.Sprintf("status:%s", appname), payload},
-
-							VolumeMounts: []corev1.VolumeMount{
-								{
-									Name:      "workspace",
-									MountPath: "/workspace",
-								},
+							Name:  "notifier",
+							Image: "redis:alpine",
+							Env: []corev1.EnvVar{
+								{Name: "APP", Value: appname},
+								{Name: "DEPID", Value: depid},
+								{Name: "REDIS_HOST", Value: "redis.default.svc.cluster.local"},
 							},
+							Command:      []string{"sh", "-c", notifyScript},
+							VolumeMounts: metaMounts(),
 						},
 					},
 				},
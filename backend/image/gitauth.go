@@ -0,0 +1,121 @@
+package image
+
+import (
+	"context"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Git credentials for private repos live next to the build jobs as
+// gitauth-<app> in the builder namespace and are mounted into pullrepo.
+
+func gitAuthName(appname string) string {
+	return "gitauth-" + appname
+}
+
+// SetGitAuth creates or replaces the clone credentials of an app. authType is
+// "ssh" (ssh-privatekey, optional known_hosts) or "token" (username, password).
+func SetGitAuth(client kubernetes.Interface, appname string, authType string, values map[string]string) error {
+	secretType := corev1.SecretTypeSSHAuth
+	switch authType {
+	case "ssh":
+		if values[corev1.SSHAuthPrivateKey] == "" {
+			return fmt.Errorf("missing ssh private key")
+		}
+	case "token":
+		secretType = corev1.SecretTypeBasicAuth
+		if values[corev1.BasicAuthPasswordKey] == "" {
+			return fmt.Errorf("missing token")
+		}
+	default:
+		return fmt.Errorf("unknown git auth type %q", authType)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      gitAuthName(appname),
+			Namespace: "builder",
+			Labels:    map[string]string{"forgepaas.io/app": appname},
+		},
+		Type:       secretType,
+		StringData: values,
+	}
+
+	secrets := client.CoreV1().Secrets("builder")
+	ctx := context.Background()
+
+	existing, err := secrets.Get(ctx, secret.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = secrets.Create(ctx, secret, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	// update in place so a build starting meanwhile never finds it missing;
+	// only a switch between ssh and token has to replace it, the type is
+	// immutable
+	if existing.Type != secretType {
+		err = secrets.Delete(ctx, secret.Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		_, err = secrets.Create(ctx, secret, metav1.CreateOptions{})
+		return err
+	}
+
+	existing.Labels = secret.Labels
+	existing.Data = nil
+	existing.StringData = values
+	_, err = secrets.Update(ctx, existing, metav1.UpdateOptions{})
+	return err
+}
+
+func DeleteGitAuth(client kubernetes.Interface, appname string) error {
+	err := client.CoreV1().Secrets("builder").Delete(context.Background(), gitAuthName(appname), metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// MountGitAuth mounts the app's clone credentials into the pullrepo
+// container when the app has any. It reports whether they were mounted.
+func MountGitAuth(client kubernetes.Interface, job *batchv1.Job, appname string) (bool, error) {
+	_, err := client.CoreV1().Secrets("builder").Get(context.Background(), gitAuthName(appname), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	spec := &job.Spec.Template.Spec
+	spec.Volumes = append(spec.Volumes, corev1.Volume{
+		Name: "git-auth",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName:  gitAuthName(appname),
+				DefaultMode: int32Ptr(0400),
+			},
+		},
+	})
+
+	for i := range spec.InitContainers {
+		if spec.InitContainers[i].Name != "pullrepo" {
+			continue
+		}
+		spec.InitContainers[i].VolumeMounts = append(spec.InitContainers[i].VolumeMounts, corev1.VolumeMount{
+			Name:      "git-auth",
+			MountPath: "/git-auth",
+			ReadOnly:  true,
+		})
+	}
+	return true, nil
+}
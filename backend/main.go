@@ -3,17 +3,22 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"minihiroku/backend/create"
 	"minihiroku/backend/image"
 	"minihiroku/backend/models"
 	"minihiroku/backend/rediss"
+	"minihiroku/backend/secure"
 	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/redis/go-redis/v9"
+	batchv1 "k8s.io/api/batch/v1"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 )
@@ -59,6 +64,18 @@ func main() {
 			log.Printf("payload: %s , %s , force : %t", consumer.Delete.UserID, consumer.Delete.AppName, consumer.Delete.Force)
 			go deleteapp(dynclient, client, consumer.Delete, rds)
 
+		} else if consumer.Queue == "rollback" {
+			log.Printf("rollback: %s to %s , depid %s", consumer.Rollback.AppName, consumer.Rollback.TargetDepId, consumer.Rollback.DepId)
+			go rollbackapp(client, consumer.Rollback, rds)
+
+		} else if consumer.Queue == "update" {
+			log.Printf("update: %s , kind %s , user %s", consumer.Update.AppName, consumer.Update.Kind, consumer.Update.UserId)
+			go updateapp(dynclient, client, consumer.Update, rds)
+
+		} else if consumer.Queue == "cancel" {
+			log.Printf("cancel: %s , depid %s , user %s", consumer.Cancel.AppName, consumer.Cancel.DepId, consumer.Cancel.UserId)
+			go cancelbuild(client, consumer.Cancel, rds)
+
 		} else {
 
 		}
@@ -66,110 +83,904 @@ func main() {
 	}
 }
 
+// deployTracker publishes progress for one deployment to logs:<app> and keeps
+// its state record and the app registry in step.
+type deployTracker struct {
+	rds     *redis.Client
+	appName string
+	depId   string
+}
+
+func (t *deployTracker) send(msg string) {
+	rediss.PublishLog(t.rds, t.appName, msg)
+}
+
+// setState moves the deployment on, the error tells when the move was
+// rejected, such as after the deployment was cancelled.
+func (t *deployTracker) setState(state, reason string) error {
+	if err := rediss.SetDeploymentState(t.rds, t.depId, t.appName, state, reason); err != nil {
+		log.Println(err)
+		return err
+	}
+	rediss.SetAppStatus(t.rds, t.appName, state)
+	return nil
+}
+
+func (t *deployTracker) fail(reason string) {
+	t.send("❌ " + reason)
+	t.setState(models.StateFailed, reason)
+}
+
+// abort fails the deployment and removes whatever this run created, so a
+// first deploy that breaks halfway leaves no namespace or half an app behind.
+func (t *deployTracker) abort(reason string, created *create.Created) {
+	t.fail(reason)
+	if created.Empty() {
+		return
+	}
+
+	removed, err := created.Undo()
+	if len(removed) > 0 {
+		t.send(fmt.Sprintf("🧹 Cleaned up %s", strings.Join(removed, ", ")))
+	}
+	if err != nil {
+		log.Printf("cleanup of %s incomplete: %v", t.appName, err)
+		t.send(fmt.Sprintf("⚠️ Cleanup incomplete, %v", err))
+	}
+}
+
+// revert puts a redeployed app back on its last live release after the new
+// rollout failed. The failed deployment keeps its state, the
+// app record points at the release that is serving again.
+func (t *deployTracker) revert(client kubernetes.Interface) {
+	last, err := rediss.LatestRelease(t.rds, t.appName)
+	if err != nil || last == nil {
+		t.send(fmt.Sprintf("⚠️ No earlier release to roll back to, %s stays on the failed rollout", t.appName))
+		return
+	}
+
+	t.send(fmt.Sprintf("⏪ Rolling back automatically to %s (%s)...", last.DepId, last.Image))
+	if _, err := create.RevertTo(client, t.appName, last.DepId, last.Image); err != nil {
+		t.send(fmt.Sprintf("❌ Automatic rollback failed: %v", err))
+		return
+	}
+	err = create.WatchRollout(client, t.appName, last.DepId, create.RolloutTimeout(), func(progress string) {
+		t.send("Rollback: " + progress)
+	})
+	if err != nil {
+		t.send(fmt.Sprintf("❌ Automatic rollback did not become healthy: %v", err))
+		return
+	}
+
+	rediss.UpdateApp(t.rds, t.appName, map[string]interface{}{
+		"depid":  last.DepId,
+		"status": models.StateLive,
+	})
+	t.send(fmt.Sprintf("⏪ %s is back on %s", t.appName, last.DepId))
+}
+
+// appPort picks the container port: the one set through the api, then a
+// PORT config var, then create.DefaultPort.
+func appPort(settings models.Settings, config map[string]string) int32 {
+	if port := create.ParsePort(settings.Port); port != 0 {
+		return port
+	}
+	if port := create.ParsePort(config["PORT"]); port != 0 {
+		return port
+	}
+	return create.DefaultPort
+}
+
+// appSize returns the cpu and memory limits set through the api, filling in
+// the defaults. custom is false for an app that was never resized.
+func appSize(settings models.Settings) (cpu string, memory string, custom bool) {
+	cpu, memory = settings.CPU, settings.Memory
+	custom = cpu != "" || memory != ""
+	if cpu == "" {
+		cpu = create.DefaultCPU
+	}
+	if memory == "" {
+		memory = create.DefaultMemory
+	}
+	return cpu, memory, custom
+}
+
+// appAutoscale returns the autoscaling policy set through the api, ok is
+// false when the app does not autoscale.
+func appAutoscale(settings models.Settings) (policy create.Autoscale, ok bool) {
+	if settings.AutoscaleMax == "" {
+		return policy, false
+	}
+	policy = create.Autoscale{
+		Min:    create.ParseReplicas(settings.AutoscaleMin),
+		Max:    create.ParseReplicas(settings.AutoscaleMax),
+		CPU:    create.ParseReplicas(settings.AutoscaleCPU),
+		Memory: create.ParseReplicas(settings.AutoscaleMemory),
+	}
+	if policy.Min < 1 || policy.Max < policy.Min || (policy.CPU <= 0 && policy.Memory <= 0) {
+		return policy, false
+	}
+	return policy, true
+}
+
+// appHealthCheck returns the probe configuration set through the api.
+func appHealthCheck(settings models.Settings) create.HealthCheck {
+	return create.HealthCheck{
+		Path:             settings.HealthPath,
+		Port:             create.ParsePort(settings.HealthPort),
+		TimeoutSeconds:   max(create.ParseReplicas(settings.HealthTimeout), 0),
+		FailureThreshold: max(create.ParseReplicas(settings.HealthThreshold), 0),
+		StartupSeconds:   max(create.ParseReplicas(settings.HealthStartup), 0),
+	}
+}
+
+// logBuildTail passes on the last log lines of the step that broke a build.
+func logBuildTail(buildErr *image.BuildError, logsend func(string)) {
+	if len(buildErr.Logs) == 0 {
+		return
+	}
+	logsend(fmt.Sprintf("Last lines of %s:", buildErr.Container))
+	for _, line := range buildErr.Logs {
+		logsend("  " + line)
+	}
+}
+
+// signalGrace is how long the signal may lag behind the build job
+// completing; the notifier pushes it as the job's last step.
+const signalGrace = 15 * time.Second
+
+var errSignalMissing = errors.New("builder signal missing")
+
+// waitForBuild waits for the builder's ready signal while watching the build
+// job, so a build that fails never leaves the pipeline waiting on redis. A
+// job Kubernetes gave up on comes back as an *image.BuildError, a job that
+// completed without its signal turning up as errSignalMissing.
+func waitForBuild(ctx context.Context, client kubernetes.Interface, rds *redis.Client, job *batchv1.Job, depid string, report func(string)) ([]string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type signal struct {
+		msg []string
+		err error
+	}
+	ready := make(chan signal, 1)
+	go func() {
+		msg, err := rediss.CheckReady(ctx, rds, depid)
+		ready <- signal{msg, err}
+	}()
+
+	watched := make(chan error, 1)
+	go func() {
+		watched <- image.WatchBuild(ctx, client, job.Name, job.Namespace, report)
+	}()
+
+	var late <-chan time.Time
+	for {
+		select {
+		case s := <-ready:
+			return s.msg, s.err
+		case err := <-watched:
+			if err != nil {
+				return nil, err
+			}
+			// job done, the signal is on its way
+			watched = nil
+			late = time.After(signalGrace)
+		case <-late:
+			return nil, errSignalMissing
+		}
+	}
+}
+
 func DeploymentPipeline(dynclient dynamic.Interface, client kubernetes.Interface, consumer *models.Create, rds *redis.Client) {
 
-	logsend := func(msg string) {
-		rediss.PublishLog(rds, consumer.AppName, msg)
+	tracker := &deployTracker{rds: rds, appName: consumer.AppName, depId: consumer.DepId}
+	logsend, setState, fail := tracker.send, tracker.setState, tracker.fail
+
+	// resources this run created, undone again if it fails
+	created := create.NewCreated(client, consumer.AppName)
+	abort := func(reason string) {
+		tracker.abort(reason, created)
 	}
 
 	defer func() {
 		if r := recover(); r != nil {
 			logsend(fmt.Sprintf("⚠️ CRITICAL ERROR: %v", r))
+			abort(fmt.Sprintf("critical error: %v", r))
 		}
 	}()
+
+	// cancelling deployCtx, with the reason as cause, is how a cancel request
+	// or a newer deploy stops this one while it is still building
+	deployCtx, cancelDeploy := context.WithCancelCause(context.Background())
+	defer cancelDeploy(nil)
+	for _, older := range trackBuild(consumer.AppName, consumer.DepId, cancelDeploy) {
+		logsend(fmt.Sprintf("Superseding deployment %s", older))
+	}
+	defer untrackBuild(consumer.DepId)
+
+	// checked once tracked, so a cancel either finds the pipeline or has
+	// already marked the deployment
+	if state, _ := rediss.DeploymentState(rds, consumer.DepId); state == models.StateCancelled {
+		logsend("Deployment was cancelled before its build started")
+		return
+	}
+
+	unlock, err := lockApp(deployCtx, consumer.AppName, consumer.DepId, func(holder string) {
+		logsend(fmt.Sprintf("Waiting for deployment %s to finish...", holder))
+	})
+	if err != nil {
+		logsend("🛑 Deployment cancelled before its build started: " + context.Cause(deployCtx).Error())
+		setState(models.StateCancelled, context.Cause(deployCtx).Error())
+		return
+	}
+	defer unlock()
+
+	// the job carries the same deadline, this only backs it up
+	buildTimeout := image.BuildTimeout()
+	buildCtx, stopTimer := context.WithTimeout(deployCtx, buildTimeout+time.Minute)
+	defer stopTimer()
+
 	logsend("Initializing build job...")
-	job, apptag := image.JobObject(consumer.GitRepo, consumer.AppName, consumer.DepId, os.Getenv("REGISTORY_URL"))
+	rediss.UpdateApp(rds, consumer.AppName, map[string]interface{}{
+		"depid": consumer.DepId,
+	})
+	if consumer.Ref != "" {
+		logsend(fmt.Sprintf("Building ref %s", consumer.Ref))
+	}
+	if consumer.BuildMode != "" && consumer.BuildMode != models.BuildModeAuto {
+		logsend(fmt.Sprintf("Build mode %s requested", consumer.BuildMode))
+	} else {
+		logsend("Looking for a Dockerfile to pick the build mode...")
+	}
+	buildMode, err := image.ResolveBuildMode(buildCtx, client, consumer.GitRepo, consumer.Ref, consumer.AppName, consumer.DepId, consumer.BuildMode)
+	if err != nil {
+		var buildErr *image.BuildError
+		switch {
+		case errors.Is(err, context.Canceled):
+			reason := context.Cause(buildCtx).Error()
+			logsend("🛑 Build cancelled: " + reason)
+			setState(models.StateCancelled, reason)
+		case errors.As(err, &buildErr):
+			logBuildTail(buildErr, logsend)
+			fail(fmt.Sprintf("Picking the build mode failed: %v", buildErr))
+		default:
+			fail(fmt.Sprintf("Picking the build mode failed: %v", err))
+		}
+		return
+	}
+	job, apptag := image.JobObject(consumer.GitRepo, consumer.Ref, consumer.AppName, consumer.DepId, buildMode, os.Getenv("REGISTORY_URL"))
 	log.Println("job created ")
 	log.Println(apptag)
 
+	private, err := image.MountGitAuth(client, job, consumer.AppName)
+	if err != nil {
+		fail(fmt.Sprintf("Loading git credentials failed: %v", err))
+		return
+	}
+	if private {
+		logsend("Using registered git credentials for clone")
+	}
+
 	runnn, err := image.JobRunner(client, job)
 	if err != nil {
-		logsend(fmt.Sprintf("❌ Job creation failed: %v", err))
+		fail(fmt.Sprintf("Job creation failed: %v", err))
 		return
 	}
 	logsend(fmt.Sprintf("Build Job started (Pod: %s)", runnn.Name))
+	setState(models.StateCloning, "")
+
+	onStage := func(stage string) {
+		switch stage {
+		case "cnd-binary", "kaniko":
+			setState(models.StateBuilding, "")
+		case "export":
+			setState(models.StatePushing, "")
+		}
+	}
 
 	go func() {
 		time.Sleep(2 * time.Second)
-		image.LogsGiver(client, runnn.Name, job.Namespace, rds, consumer.AppName)
+		image.LogsGiver(buildCtx, client, runnn.Name, job.Namespace, rds, consumer.AppName, onStage)
 	}()
 
 	logsend("Waiting for build to complete...")
-	check, err := rediss.CheckReady(rds, consumer.AppName)
-	if err != nil || len(check) < 2 {
-		logsend("❌ Error receiving completion signal from builder")
+	check, err := waitForBuild(buildCtx, client, rds, runnn, consumer.DepId, logsend)
+	defer rediss.ClearReady(rds, consumer.DepId)
+	if err != nil {
+		var buildErr *image.BuildError
+		switch {
+		case errors.Is(err, context.Canceled):
+			if err := image.CancelBuild(client, consumer.AppName, consumer.DepId); err != nil {
+				log.Printf("cancel build %s: %v", runnn.Name, err)
+			}
+			reason := context.Cause(buildCtx).Error()
+			logsend("🛑 Build cancelled: " + reason)
+			setState(models.StateCancelled, reason)
+		case errors.As(err, &buildErr):
+			logBuildTail(buildErr, logsend)
+			fail(buildErr.Error())
+		case errors.Is(err, context.DeadlineExceeded):
+			if err := image.CancelBuild(client, consumer.AppName, consumer.DepId); err != nil {
+				log.Printf("cancel build %s: %v", runnn.Name, err)
+			}
+			fail(fmt.Sprintf("Build timed out after %s", buildTimeout))
+		case errors.Is(err, image.ErrBuildJobRemoved):
+			fail("Build job was removed before the build finished")
+		case errors.Is(err, errSignalMissing):
+			fail(fmt.Sprintf("Build job completed but the %s after %s", err, signalGrace))
+		default:
+			fail(fmt.Sprintf("Error receiving completion signal from builder: %v", err))
+		}
+		return
+	}
+	if len(check) < 2 {
+		fail("Error receiving completion signal from builder")
 		return
 	}
 
-	var msg map[string]interface{}
-	if err := json.Unmarshal([]byte(check[1]), &msg); err != nil {
+	var signal models.BuildSignal
+	if err := json.Unmarshal([]byte(check[1]), &signal); err != nil {
 		log.Println("invalid json:", err)
+		fail("Invalid completion signal from builder")
+		return
+	}
+	if err := signal.Validate(consumer.AppName, consumer.DepId); err != nil {
+		log.Printf("rejected build signal %s: %v", check[1], err)
+		fail(fmt.Sprintf("Invalid completion signal from builder: %v", err))
+		return
+	}
+	log.Printf("build signal for %s: %s", consumer.DepId, check[1])
+
+	info := map[string]interface{}{
+		"build_mode":     signal.Mode,
+		"build_duration": signal.Duration,
+		"buildpacks":     strings.Join(signal.Buildpacks, ","),
+	}
+	if signal.Commit != "" {
+		info["commit"] = signal.Commit
+		logsend(fmt.Sprintf("Built commit %s", signal.Commit))
+	}
+	if signal.Digest != "" {
+		info["digest"] = signal.Digest
+	}
+	rediss.SetDeploymentInfo(rds, consumer.DepId, info)
 
+	if signal.Status == models.BuildFailed {
+		if err := image.CancelBuild(client, consumer.AppName, consumer.DepId); err != nil {
+			log.Printf("cancel build %s: %v", runnn.Name, err)
+		}
+		fail(fmt.Sprintf("Build failed: %s build exited with code %d after %ds", signal.Mode, signal.ExitCode, signal.Duration))
 		return
 	}
-	log.Println("got the image ready signal  ")
-	log.Println(check)
+
 	apptag = os.Getenv("REGISTORY_CLUSTER_IP") + "/" + apptag
+	if len(signal.Buildpacks) > 0 {
+		logsend(fmt.Sprintf("Buildpacks: %s", strings.Join(signal.Buildpacks, ", ")))
+	}
+	logsend(fmt.Sprintf("Image %s built with %s in %ds", signal.Digest, signal.Mode, signal.Duration))
 
-	if msg["status"] == "ready" {
-		logsend("Build successful. Starting deployment...")
-		dep := create.CreateDep(apptag, consumer.DepId, consumer.AppName)
-		runn, err := create.DeplomentRunner(client, dep, consumer.AppName)
+	// past this point the deployment can no longer be cancelled
+	if !finishBuild(consumer.DepId) {
+		reason := "cancelled"
+		if cause := context.Cause(deployCtx); cause != nil {
+			reason = cause.Error()
+		}
+		logsend("🛑 Build cancelled: " + reason)
+		setState(models.StateCancelled, reason)
+		return
+	}
+	if err := setState(models.StateDeploying, ""); err != nil {
+		logsend(fmt.Sprintf("🛑 Not deploying: %v", err))
+		return
+	}
+	logsend("Build successful. Starting deployment...")
+	config, err := rediss.GetConfig(rds, consumer.AppName)
+	if err != nil {
+		fail(fmt.Sprintf("Loading app config failed: %v", err))
+		return
+	}
+	settings, err := rediss.GetSettings(rds, consumer.AppName)
+	if err != nil {
+		fail(fmt.Sprintf("Loading app settings failed: %v", err))
+		return
+	}
+
+	nsCreated, err := create.EnsureNamespace(client, consumer.AppName)
+	if err != nil {
+		fail(fmt.Sprintf("Namespace creation failed: %v", err))
+		return
+	}
+	created.Add(create.ResourceNamespace, nsCreated)
+
+	if err := create.ApplyConfig(client, consumer.AppName, config); err != nil {
+		abort(fmt.Sprintf("Applying app config failed: %v", err))
+		return
+	}
+	port := appPort(settings, config)
+	logsend(fmt.Sprintf("App will listen on port %d", port))
+
+	secretsVersion, err := create.SecretsVersion(client, consumer.AppName)
+	if err != nil {
+		abort(fmt.Sprintf("Loading app secrets failed: %v", err))
+		return
+	}
 
+	dep := create.CreateDep(apptag, consumer.DepId, consumer.AppName, port)
+	dep.Spec.Template.Annotations[create.ConfigHashAnnotation] = create.ConfigHash(config)
+	if secretsVersion != "" {
+		dep.Spec.Template.Annotations[create.SecretsVersionAnnotation] = secretsVersion
+	}
+	create.SetProbes(dep, appHealthCheck(settings), port)
+	policy, autoscale := appAutoscale(settings)
+	if autoscale {
+		dep.Spec.Replicas = &policy.Min
+	} else if replicas := create.ParseReplicas(settings.Replicas); replicas >= 0 {
+		dep.Spec.Replicas = &replicas
+	}
+	if cpu, memory, custom := appSize(settings); custom {
+		res, err := create.Resources(cpu, memory)
 		if err != nil {
-			logsend(fmt.Sprintf("❌ Deployment failed: %v", err))
+			abort(fmt.Sprintf("Invalid app size: %v", err))
 			return
 		}
-		logsend(fmt.Sprintf("Deployment created (UID: %s)", runn.UID))
+		create.SetResources(dep, res)
+	}
+	runn, redeploy, err := create.DeplomentRunner(client, dep, consumer.AppName)
 
-		errr := create.CreateService(client, runn.Namespace, consumer.AppName)
+	if err != nil {
+		abort(fmt.Sprintf("Deployment failed: %v", err))
+		return
+	}
+	// a redeploy keeps what it finds, only first deploys are undone
+	created.Add(create.ResourceDeployment, !redeploy)
+	if redeploy {
+		logsend(fmt.Sprintf("Existing app found, rolling update to %s (UID: %s)", apptag, runn.UID))
+	} else {
+		logsend(fmt.Sprintf("Deployment created (UID: %s)", runn.UID))
+	}
 
-		if errr != nil {
-			log.Println(errr)
-			logsend(fmt.Sprintf("❌ Service creation failed: %v", err))
+	if autoscale {
+		hpaCreated, err := create.ApplyAutoscale(client, consumer.AppName, policy)
+		if err != nil {
+			abort(fmt.Sprintf("Autoscaler setup failed: %v", err))
 			return
 		}
-		logsend("Service exposed internally.")
-		log.Println("service created ")
-		time.Sleep(10 * time.Second)
-		rout := create.CreateRoute(dynclient, consumer.AppName, os.Getenv("DOMAIN"), runn.Namespace)
-		if rout != nil {
-			logsend(fmt.Sprintf("❌ Route creation failed: %v", rout))
-			return
+		created.Add(create.ResourceHPA, hpaCreated && !redeploy)
+		logsend(fmt.Sprintf("Autoscaling between %d and %d replicas", policy.Min, policy.Max))
+	} else if err := create.DeleteAutoscale(client, consumer.AppName); err != nil {
+		abort(fmt.Sprintf("Autoscaler removal failed: %v", err))
+		return
+	}
+
+	logsend("Waiting for the rollout to become available...")
+	err = create.WatchRollout(client, consumer.AppName, consumer.DepId, create.RolloutTimeout(), func(progress string) {
+		logsend("Rollout: " + progress)
+	})
+	if err != nil {
+		abort(fmt.Sprintf("Rollout failed: %v", err))
+		if redeploy {
+			tracker.revert(client)
+		}
+		return
+	}
+	logsend("All replicas are up and ready.")
+
+	// the service only moves once the new pods are healthy, so a
+	// reverted rollout keeps serving on the old port
+	svcCreated, errr := create.CreateService(client, runn.Namespace, consumer.AppName, port)
+
+	if errr != nil {
+		log.Println(errr)
+		abort(fmt.Sprintf("Service creation failed: %v", errr))
+		return
+	}
+	created.Add(create.ResourceService, svcCreated && !redeploy)
+	logsend("Service exposed internally.")
+	log.Println("service created ")
+
+	setState(models.StateRouting, "")
+	_, rout := create.CreateRoute(dynclient, consumer.AppName, os.Getenv("DOMAIN"), runn.Namespace, port)
+	if rout != nil {
+		abort(fmt.Sprintf("Route creation failed: %v", rout))
+		return
+	}
+	log.Println("route created ")
+	finalURL := fmt.Sprintf("http://%s.%s", consumer.AppName, os.Getenv("DOMAIN"))
+
+	log.Println("deployment info ", runn.Name, runn.Namespace, runn.UID)
+	rediss.UpdateApp(rds, consumer.AppName, map[string]interface{}{
+		"url": finalURL,
+	})
+	err = rediss.AddRelease(rds, consumer.AppName, models.Release{
+		DepId:     consumer.DepId,
+		Image:     apptag,
+		GitRepo:   consumer.GitRepo,
+		Ref:       consumer.Ref,
+		Commit:    signal.Commit,
+		UserId:    consumer.UserId,
+		Timestamp: time.Now().Unix(),
+	})
+	if err != nil {
+		log.Println("release not recorded:", err)
+	}
+	setState(models.StateLive, "")
+	logsend(fmt.Sprintf("🎉 SUCCESS! Your app is live at: %s", finalURL))
+
+}
+
+// cancelbuild stops the build of a deployment. A build running in this
+// worker is stopped through its pipeline, which removes the job and records
+// the cancellation; one already deploying is left alone. Only when no
+// pipeline here owns the deployment, say after a worker restart, is the job
+// removed here and the deployment marked cancelled if it never got past the
+// build.
+func cancelbuild(client kubernetes.Interface, consumer *models.Cancel, rds *redis.Client) {
+	tracker := &deployTracker{rds: rds, appName: consumer.AppName, depId: consumer.DepId}
+
+	found, stopped := stopBuild(consumer.DepId)
+	if stopped {
+		return
+	}
+	if found {
+		tracker.send(fmt.Sprintf("⚠️ Deployment %s is already deploying and can no longer be cancelled", consumer.DepId))
+		return
+	}
+
+	state, err := rediss.DeploymentState(rds, consumer.DepId)
+	if err != nil {
+		log.Printf("cancel %s: %v", consumer.DepId, err)
+		return
+	}
+	switch state {
+	case models.StateQueued, models.StateCloning, models.StateBuilding, models.StatePushing:
+	default:
+		log.Printf("cancel %s: nothing to cancel in state %q", consumer.DepId, state)
+		return
+	}
+
+	if err := image.CancelBuild(client, consumer.AppName, consumer.DepId); err != nil {
+		log.Printf("cancel build %s: %v", consumer.DepId, err)
+	}
+	tracker.send("🛑 Build cancelled")
+	tracker.setState(models.StateCancelled, "cancelled by user")
+}
+
+func rollbackapp(client kubernetes.Interface, consumer *models.Rollback, rds *redis.Client) {
+	tracker := &deployTracker{rds: rds, appName: consumer.AppName, depId: consumer.DepId}
+	logsend, setState, fail := tracker.send, tracker.setState, tracker.fail
+
+	// a rollback takes its turn like any deployment of the app and can be
+	// cancelled or superseded until it starts deploying
+	deployCtx, cancelDeploy := context.WithCancelCause(context.Background())
+	defer cancelDeploy(nil)
+	for _, older := range trackBuild(consumer.AppName, consumer.DepId, cancelDeploy) {
+		logsend(fmt.Sprintf("Superseding deployment %s", older))
+	}
+	defer untrackBuild(consumer.DepId)
+
+	if state, _ := rediss.DeploymentState(rds, consumer.DepId); state == models.StateCancelled {
+		logsend("Rollback was cancelled before it started")
+		return
+	}
+
+	unlock, err := lockApp(deployCtx, consumer.AppName, consumer.DepId, func(holder string) {
+		logsend(fmt.Sprintf("Waiting for deployment %s to finish...", holder))
+	})
+	if err != nil {
+		logsend("🛑 Rollback cancelled before it started: " + context.Cause(deployCtx).Error())
+		setState(models.StateCancelled, context.Cause(deployCtx).Error())
+		return
+	}
+	defer unlock()
+
+	if !finishBuild(consumer.DepId) {
+		reason := "cancelled"
+		if cause := context.Cause(deployCtx); cause != nil {
+			reason = cause.Error()
 		}
-		log.Println("route created ")
-		finalURL := fmt.Sprintf("http://%s.%s", consumer.AppName, os.Getenv("DOMAIN"))
+		logsend("🛑 Rollback cancelled: " + reason)
+		setState(models.StateCancelled, reason)
+		return
+	}
+	if err := setState(models.StateDeploying, ""); err != nil {
+		logsend(fmt.Sprintf("🛑 Not rolling back: %v", err))
+		return
+	}
 
-		log.Println("deployment info ", runn.Name, runn.Namespace, runn.UID)
-		logsend(fmt.Sprintf("🎉 SUCCESS! Your app is live at: %s", finalURL))
+	rediss.UpdateApp(rds, consumer.AppName, map[string]interface{}{
+		"depid": consumer.DepId,
+	})
 
+	target, err := rediss.GetRelease(rds, consumer.AppName, consumer.TargetDepId)
+	if err != nil {
+		fail(fmt.Sprintf("Rollback failed: %v", err))
+		return
 	}
 
+	logsend(fmt.Sprintf("Rolling back to %s (%s)...", target.DepId, target.Image))
+
+	runn, err := create.SetImage(client, consumer.AppName, target.Image, consumer.DepId)
+	if err != nil {
+		fail(fmt.Sprintf("Rollback failed: %v", err))
+		return
+	}
+	log.Println("rollback info ", runn.Name, runn.Namespace, runn.UID)
+
+	err = create.WatchRollout(client, consumer.AppName, consumer.DepId, create.RolloutTimeout(), func(progress string) {
+		logsend("Rollout: " + progress)
+	})
+	if err != nil {
+		fail(fmt.Sprintf("Rollback rollout failed: %v", err))
+		return
+	}
+
+	err = rediss.AddRelease(rds, consumer.AppName, models.Release{
+		DepId:      consumer.DepId,
+		Image:      target.Image,
+		GitRepo:    target.GitRepo,
+		Ref:        target.Ref,
+		Commit:     target.Commit,
+		UserId:     consumer.UserId,
+		Timestamp:  time.Now().Unix(),
+		RollbackOf: target.DepId,
+	})
+	if err != nil {
+		log.Println("release not recorded:", err)
+	}
+	setState(models.StateLive, "")
+	logsend(fmt.Sprintf("⏪ Rolled back %s to %s", consumer.AppName, target.DepId))
 }
 
-func deleteapp(dynclient dynamic.Interface, client kubernetes.Interface, consumer *models.Delete, rds *redis.Client) {
-	force := consumer.Force
-	appname := consumer.AppName
+func updateapp(dynclient dynamic.Interface, client kubernetes.Interface, consumer *models.Update, rds *redis.Client) {
+	logsend := func(msg string) {
+		rediss.PublishLog(rds, consumer.AppName, msg)
+	}
 
-	if force == true {
-		err := create.InstDelete(client, dynclient, appname, appname)
+	switch consumer.Kind {
+	case "gitauth":
+		values, err := secure.Open(consumer.Sealed)
 		if err != nil {
-			log.Println(err)
+			log.Println("git credentials not readable:", err)
+			logsend("❌ Git credentials could not be decrypted")
+			return
 		}
-		err = create.DeleteNamespace(client, appname)
+		err = image.SetGitAuth(client, consumer.AppName, consumer.Data["type"], values)
 		if err != nil {
-			log.Println(err)
+			logsend(fmt.Sprintf("❌ Saving git credentials failed: %v", err))
+			return
 		}
+		logsend(fmt.Sprintf("🔑 Git %s credentials saved", consumer.Data["type"]))
 
-	} else {
-		err := create.Deletegracefully(client, dynclient, appname, appname)
+	case "config":
+		config, err := rediss.GetConfig(rds, consumer.AppName)
+		if err != nil {
+			logsend(fmt.Sprintf("❌ Loading app config failed: %v", err))
+			return
+		}
+		if err := create.ApplyConfig(client, consumer.AppName, config); err != nil {
+			logsend(fmt.Sprintf("❌ Applying app config failed: %v", err))
+			return
+		}
+		restarted, err := create.RestartForConfig(client, consumer.AppName, create.ConfigHash(config))
+		if err != nil {
+			logsend(fmt.Sprintf("❌ Restarting app for new config failed: %v", err))
+			return
+		}
+		if restarted {
+			logsend(fmt.Sprintf("⚙️ Config updated (%d vars), rolling restart started", len(config)))
+		} else {
+			logsend(fmt.Sprintf("⚙️ Config updated (%d vars), applied on next deploy", len(config)))
+		}
+
+	case "secrets-set", "secrets-unset":
+		// only key names ever reach the log channel
+		keys := make([]string, 0, len(consumer.Data))
+		for key := range consumer.Data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var version string
+		var err error
+		if consumer.Kind == "secrets-set" {
+			values, openErr := secure.Open(consumer.Sealed)
+			if openErr != nil {
+				log.Println("secrets not readable:", openErr)
+				logsend("❌ Secrets could not be decrypted")
+				return
+			}
+			version, err = create.SetSecrets(client, consumer.AppName, values)
+		} else {
+			version, err = create.UnsetSecrets(client, consumer.AppName, keys)
+		}
+		if err != nil {
+			logsend(fmt.Sprintf("❌ Updating secrets %s failed: %v", strings.Join(keys, ", "), err))
+			return
+		}
+
+		restarted, err := create.RestartForSecrets(client, consumer.AppName, version)
+		if err != nil {
+			logsend(fmt.Sprintf("❌ Restarting app for new secrets failed: %v", err))
+			return
+		}
+		if restarted {
+			logsend(fmt.Sprintf("🔒 Secrets %s updated, rolling restart started", strings.Join(keys, ", ")))
+		} else {
+			logsend(fmt.Sprintf("🔒 Secrets %s updated, applied on next deploy", strings.Join(keys, ", ")))
+		}
+
+	case "port":
+		config, err := rediss.GetConfig(rds, consumer.AppName)
+		if err != nil {
+			logsend(fmt.Sprintf("❌ Loading app config failed: %v", err))
+			return
+		}
+		settings, err := rediss.GetSettings(rds, consumer.AppName)
+		if err != nil {
+			logsend(fmt.Sprintf("❌ Loading app settings failed: %v", err))
+			return
+		}
+		port := appPort(settings, config)
+		moved, err := create.ApplyPort(client, dynclient, consumer.AppName, os.Getenv("DOMAIN"), port)
+		if err != nil {
+			logsend(fmt.Sprintf("❌ Moving app to port %d failed: %v", port, err))
+			return
+		}
+		if moved {
+			logsend(fmt.Sprintf("🔌 Port set to %d, rolling restart started", port))
+		} else {
+			logsend(fmt.Sprintf("🔌 Port set to %d, applied on next deploy", port))
+		}
+
+	case "scale":
+		replicas := create.ParseReplicas(consumer.Data["replicas"])
+		if replicas < 0 {
+			logsend(fmt.Sprintf("❌ Invalid replica count %q", consumer.Data["replicas"]))
+			return
+		}
+		scaled, err := create.ScaleApp(client, consumer.AppName, replicas)
+		if err != nil {
+			logsend(fmt.Sprintf("❌ Scaling to %d replicas failed: %v", replicas, err))
+			return
+		}
+		if scaled {
+			logsend(fmt.Sprintf("📈 Scaled to %d replicas", replicas))
+		} else {
+			logsend(fmt.Sprintf("📈 Replicas set to %d, applied on first deploy", replicas))
+		}
+
+	case "resize":
+		settings, err := rediss.GetSettings(rds, consumer.AppName)
 		if err != nil {
-			log.Println(err)
+			logsend(fmt.Sprintf("❌ Loading app settings failed: %v", err))
+			return
 		}
-		err = create.DeleteNamespace(client, appname)
+		cpu, memory, _ := appSize(settings)
+		res, err := create.Resources(cpu, memory)
 		if err != nil {
-			log.Println(err)
+			logsend(fmt.Sprintf("❌ Invalid app size: %v", err))
+			return
+		}
+		resized, err := create.ResizeApp(client, consumer.AppName, res)
+		if err != nil {
+			logsend(fmt.Sprintf("❌ Resizing to %s cpu / %s memory failed: %v", cpu, memory, err))
+			return
+		}
+		if resized {
+			logsend(fmt.Sprintf("📐 Resized to %s cpu / %s memory, rolling restart started", cpu, memory))
+		} else {
+			logsend(fmt.Sprintf("📐 Size set to %s cpu / %s memory, applied on next deploy", cpu, memory))
 		}
 
+	case "autoscale":
+		settings, err := rediss.GetSettings(rds, consumer.AppName)
+		if err != nil {
+			logsend(fmt.Sprintf("❌ Loading app settings failed: %v", err))
+			return
+		}
+		policy, ok := appAutoscale(settings)
+		if !ok {
+			logsend("❌ Invalid autoscaling policy")
+			return
+		}
+		deployed, err := create.DeploymentExists(client, consumer.AppName)
+		if err != nil {
+			logsend(fmt.Sprintf("❌ Enabling autoscaling failed: %v", err))
+			return
+		}
+		if !deployed {
+			logsend(fmt.Sprintf("📈 Autoscaling %d-%d replicas set, applied on next deploy", policy.Min, policy.Max))
+			return
+		}
+		if _, err := create.ApplyAutoscale(client, consumer.AppName, policy); err != nil {
+			logsend(fmt.Sprintf("❌ Enabling autoscaling failed: %v", err))
+			return
+		}
+		logsend(fmt.Sprintf("📈 Autoscaling between %d and %d replicas", policy.Min, policy.Max))
+
+	case "autoscale-delete":
+		if err := create.DeleteAutoscale(client, consumer.AppName); err != nil {
+			logsend(fmt.Sprintf("❌ Disabling autoscaling failed: %v", err))
+			return
+		}
+		logsend("📈 Autoscaling disabled, replica count stays as it is")
+
+	case "health":
+		settings, err := rediss.GetSettings(rds, consumer.AppName)
+		if err != nil {
+			logsend(fmt.Sprintf("❌ Loading app settings failed: %v", err))
+			return
+		}
+		check := appHealthCheck(settings)
+		target := "port check"
+		if check.Path != "" {
+			target = "GET " + check.Path
+		}
+		applied, err := create.ApplyHealthCheck(client, consumer.AppName, check)
+		if err != nil {
+			logsend(fmt.Sprintf("❌ Updating health checks failed: %v", err))
+			return
+		}
+		if applied {
+			logsend(fmt.Sprintf("🩺 Health checks set to %s, rolling restart started", target))
+		} else {
+			logsend(fmt.Sprintf("🩺 Health checks set to %s, applied on next deploy", target))
+		}
+
+	case "gitauth-delete":
+		if err := image.DeleteGitAuth(client, consumer.AppName); err != nil {
+			logsend(fmt.Sprintf("❌ Removing git credentials failed: %v", err))
+			return
+		}
+		logsend("Git credentials removed")
+
+	default:
+		log.Printf("unknown update kind %q for %s", consumer.Kind, consumer.AppName)
+	}
+}
+
+func deleteapp(dynclient dynamic.Interface, client kubernetes.Interface, consumer *models.Delete, rds *redis.Client) {
+	appname := consumer.AppName
+	logsend := func(msg string) {
+		rediss.PublishLog(rds, appname, msg)
 	}
+
+	rediss.SetDeletionState(rds, appname, "deleting")
+
+	var summary *create.DeleteSummary
+	if consumer.Force {
+		logsend("Force deleting app resources...")
+		// stop a deploy in flight from bringing the app back
+		cancelled, buildErr := image.CancelBuilds(client, appname)
+		if cancelled > 0 {
+			logsend(fmt.Sprintf("Cancelled %d build job(s)", cancelled))
+		}
+		summary = create.InstDelete(client, dynclient, appname, appname, logsend)
+		if buildErr != nil {
+			summary.Record("build", buildErr)
+		}
+	} else {
+		drain := create.DrainPeriod()
+		if consumer.Drain > 0 {
+			drain = time.Duration(consumer.Drain) * time.Second
+		}
+		logsend("Deleting app resources gracefully...")
+		summary = create.Deletegracefully(client, dynclient, appname, appname, drain, logsend)
+	}
+	if err := image.DeleteGitAuth(client, appname); err != nil {
+		summary.Record("gitauth", err)
+	}
+	log.Printf("delete %s: %s", appname, summary)
+
+	if err := summary.Err(); err != nil {
+		rediss.FinishDeletion(rds, appname, "failed", summary.Removed, summary.Missing, summary.Failed)
+		rediss.SetAppStatus(rds, appname, "delete_failed")
+		logsend(fmt.Sprintf("❌ Delete incomplete: %s", summary))
+		return
+	}
+
+	rediss.FinishDeletion(rds, appname, "deleted", summary.Removed, summary.Missing, summary.Failed)
+	rediss.RemoveApp(rds, appname)
+	logsend(fmt.Sprintf("🗑️ App deleted: %s", summary))
 }
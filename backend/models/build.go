@@ -0,0 +1,70 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Build signal statuses pushed by the notifier container.
+const (
+	BuildReady  = "ready"
+	BuildFailed = "failed"
+)
+
+// Build modes. Auto builds with the repo's Dockerfile when it has one and
+// with buildpacks otherwise; the signal always names the mode used.
+const (
+	BuildModeAuto       = "auto"
+	BuildModeBuildpacks = "buildpacks"
+	BuildModeDockerfile = "dockerfile"
+)
+
+var digestPattern = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// BuildSignal is what the notifier container of a build job pushes to
+// status:<depid> once the buildpacks have run.
+type BuildSignal struct {
+	DepId      string   `json:"depid"`
+	App        string   `json:"app"`
+	Status     string   `json:"status"`
+	Mode       string   `json:"mode"`
+	ExitCode   int      `json:"exit_code"`
+	Commit     string   `json:"commit"`
+	Digest     string   `json:"digest"`
+	Buildpacks []string `json:"buildpacks"`
+	StartedAt  int64    `json:"started_at"`
+	FinishedAt int64    `json:"finished_at"`
+	Duration   int64    `json:"duration"`
+	Timestamp  int64    `json:"timestamp"`
+}
+
+// Validate checks the signal belongs to deployment depid of app and is
+// complete enough to act on; a ready build must name the image digest.
+func (s *BuildSignal) Validate(app string, depid string) error {
+	if s.DepId != depid {
+		return fmt.Errorf("signal is for deployment %q", s.DepId)
+	}
+	if s.App != app {
+		return fmt.Errorf("signal is for app %q", s.App)
+	}
+	if s.Timestamp <= 0 {
+		return fmt.Errorf("signal has no timestamp")
+	}
+	if s.Mode != BuildModeBuildpacks && s.Mode != BuildModeDockerfile {
+		return fmt.Errorf("unknown build mode %q", s.Mode)
+	}
+
+	switch s.Status {
+	case BuildReady:
+		if s.ExitCode != 0 {
+			return fmt.Errorf("ready signal with exit code %d", s.ExitCode)
+		}
+		if !digestPattern.MatchString(s.Digest) {
+			return fmt.Errorf("ready signal without a valid image digest (%q)", s.Digest)
+		}
+	case BuildFailed:
+	default:
+		return fmt.Errorf("unknown build status %q", s.Status)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package models
+
+// Deployment states, in the order a healthy deployment moves through them.
+const (
+	StateQueued    = "queued"
+	StateCloning   = "cloning"
+	StateBuilding  = "building"
+	StatePushing   = "pushing"
+	StateDeploying = "deploying"
+	StateRouting   = "routing"
+	StateLive      = "live"
+	StateFailed    = "failed"
+	StateCancelled = "cancelled"
+)
+
+var stateOrder = map[string]int{
+	StateQueued:    0,
+	StateCloning:   1,
+	StateBuilding:  2,
+	StatePushing:   3,
+	StateDeploying: 4,
+	StateRouting:   5,
+	StateLive:      6,
+}
+
+func IsTerminalState(state string) bool {
+	return state == StateLive || state == StateFailed || state == StateCancelled
+}
+
+// CanTransition reports whether a deployment may move from one state to
+// another. Progress only goes forward (steps may be skipped), any running
+// deployment may fail or be cancelled, and terminal states are final.
+func CanTransition(from, to string) bool {
+	if IsTerminalState(from) {
+		return false
+	}
+	if to == StateFailed || to == StateCancelled {
+		return true
+	}
+
+	fromIdx, ok := stateOrder[from]
+	if !ok {
+		return false
+	}
+	toIdx, ok := stateOrder[to]
+	if !ok {
+		return false
+	}
+	return toIdx > fromIdx
+}
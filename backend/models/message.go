@@ -1,15 +1,59 @@
 package models
 
 type Create struct {
-	GitRepo string `json:"gitrepo"`
-	DepId   string `json:"DepId"`
-	AppName string `json:"appName"`
+	GitRepo   string `json:"gitrepo"`
+	DepId     string `json:"DepId"`
+	AppName   string `json:"appName"`
+	UserId    string `json:"userid"`
+	Ref       string `json:"ref"`
+	BuildMode string `json:"buildmode,omitempty"`
 }
 
+// Delete removes an app. Drain is how many seconds a graceful delete lets
+// in-flight requests finish after the route is gone, 0 for the default.
 type Delete struct {
 	UserID  string `json:"userId"`
 	AppName string `json:"appname"`
 	Force   bool   `json:"force"`
+	Drain   int    `json:"drain,omitempty"`
+}
+
+// Rollback repoints an app at the image of an earlier release. DepId is the
+// new deployment tracking the rollback, TargetDepId the release rolled back to.
+type Rollback struct {
+	AppName     string `json:"appname"`
+	DepId       string `json:"depid"`
+	TargetDepId string `json:"target_depid"`
+	UserId      string `json:"userid"`
+}
+
+// Cancel stops the build of deployment DepId of an app.
+type Cancel struct {
+	AppName string `json:"appname"`
+	DepId   string `json:"depid"`
+	UserId  string `json:"userid"`
+}
+
+// Update asks the worker to change an app's cluster resources outside of a
+// deployment. Sealed carries sensitive values encrypted by the api.
+type Update struct {
+	AppName string            `json:"appname"`
+	Kind    string            `json:"kind"`
+	UserId  string            `json:"userid"`
+	Data    map[string]string `json:"data,omitempty"`
+	Sealed  string            `json:"sealed,omitempty"`
+}
+
+// Release is one entry of the releases:<app> history, newest first.
+type Release struct {
+	DepId      string `json:"depid"`
+	Image      string `json:"image"`
+	GitRepo    string `json:"gitrepo"`
+	Ref        string `json:"ref,omitempty"`
+	Commit     string `json:"commit,omitempty"`
+	UserId     string `json:"userid"`
+	Timestamp  int64  `json:"timestamp"`
+	RollbackOf string `json:"rollback_of,omitempty"`
 }
 
 type Job struct {
@@ -17,7 +61,10 @@ type Job struct {
 	Name string `json:"name"`
 }
 type QueueResult struct {
-	Queue  string
-	Create *Create
-	Delete *Delete
+	Queue    string
+	Create   *Create
+	Delete   *Delete
+	Rollback *Rollback
+	Update   *Update
+	Cancel   *Cancel
 }
@@ -0,0 +1,21 @@
+package models
+
+// Settings are the per-app runtime options set through the api and kept on
+// the app:<name> record. Empty fields mean the platform default.
+type Settings struct {
+	Port     string `redis:"port"`
+	Replicas string `redis:"replicas"`
+	CPU      string `redis:"cpu"`
+	Memory   string `redis:"memory"`
+
+	AutoscaleMin    string `redis:"autoscale_min"`
+	AutoscaleMax    string `redis:"autoscale_max"`
+	AutoscaleCPU    string `redis:"autoscale_cpu"`
+	AutoscaleMemory string `redis:"autoscale_memory"`
+
+	HealthPath      string `redis:"health_path"`
+	HealthPort      string `redis:"health_port"`
+	HealthTimeout   string `redis:"health_timeout"`
+	HealthThreshold string `redis:"health_threshold"`
+	HealthStartup   string `redis:"health_startup"`
+}
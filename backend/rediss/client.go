@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"minihiroku/backend/models"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -27,14 +28,35 @@ func test(rdb *redis.Client) bool {
 
 }
 
-func CheckReady(rdb *redis.Client, appname string) ([]string, error) {
-	queue := fmt.Sprintf("status:%s", appname)
-	msg, err := rdb.BRPop(context.Background(), 0, queue).Result()
-	if err != nil {
-		return nil, err
+// CheckReady waits for the builder's signal on status:<depid> until ctx
+// ends. It polls in short blocking pops so a cancelled build does not leave
+// the caller stuck on redis.
+func CheckReady(ctx context.Context, rdb *redis.Client, depid string) ([]string, error) {
+	queue := statusKey(depid)
+	for {
+		msg, err := rdb.BRPop(ctx, 2*time.Second, queue).Result()
+		if err == nil {
+			return msg, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != redis.Nil {
+			return nil, err
+		}
 	}
-	return msg, nil
+}
+
+// ClearReady drops signals left on status:<depid>, such as those of build
+// attempts retried after the first signal was taken.
+func ClearReady(rdb *redis.Client, depid string) {
+	if err := rdb.Del(context.Background(), statusKey(depid)).Err(); err != nil {
+		log.Printf("clearing %s failed: %v", statusKey(depid), err)
+	}
+}
 
+func statusKey(depid string) string {
+	return "status:" + depid
 }
 
 func StartConsumer(ctx context.Context, rdb *redis.Client) (*models.QueueResult, error) {
@@ -43,13 +65,16 @@ func StartConsumer(ctx context.Context, rdb *redis.Client) (*models.QueueResult,
 		return nil, fmt.Errorf("redis stopped ")
 	}
 	for {
-		msg, err := rdb.BRPop(context.Background(), 0, "create_queue", "delete_queue").Result()
+		msg, err := rdb.BRPop(context.Background(), 0, "create_queue", "delete_queue", "rollback_queue", "update_queue", "cancel_queue").Result()
 		if err != nil {
 			continue
 		}
 
 		var crr models.Create
 		var dell models.Delete
+		var roll models.Rollback
+		var upd models.Update
+		var cnl models.Cancel
 
 		queue := msg[0]
 
@@ -68,6 +93,27 @@ func StartConsumer(ctx context.Context, rdb *redis.Client) (*models.QueueResult,
 			}
 			return &models.QueueResult{Queue: "delete", Delete: &dell}, nil
 
+		case "rollback_queue":
+			err := json.Unmarshal([]byte(msg[1]), &roll)
+			if err != nil {
+				return nil, err
+			}
+			return &models.QueueResult{Queue: "rollback", Rollback: &roll}, nil
+
+		case "update_queue":
+			err := json.Unmarshal([]byte(msg[1]), &upd)
+			if err != nil {
+				return nil, err
+			}
+			return &models.QueueResult{Queue: "update", Update: &upd}, nil
+
+		case "cancel_queue":
+			err := json.Unmarshal([]byte(msg[1]), &cnl)
+			if err != nil {
+				return nil, err
+			}
+			return &models.QueueResult{Queue: "cancel", Cancel: &cnl}, nil
+
 		}
 
 	}
@@ -82,3 +128,61 @@ func PublishLog(rds *redis.Client, appName, message string) {
 
 	log.Println(appName, ":", message)
 }
+
+// updateExisting sets hash fields only when the hash is there, so a late
+// update never brings back a record RemoveApp already dropped.
+var updateExisting = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+  return 0
+end
+redis.call("HSET", KEYS[1], unpack(ARGV))
+return 1
+`)
+
+// UpdateApp sets fields on the app:<name> registry record written by the api.
+// Apps the api never registered are left alone.
+func UpdateApp(rds *redis.Client, appName string, fields map[string]interface{}) {
+	fields["updated_at"] = time.Now().Unix()
+
+	args := make([]interface{}, 0, 2*len(fields))
+	for field, value := range fields {
+		args = append(args, field, value)
+	}
+	err := updateExisting.Run(context.Background(), rds, []string{"app:" + appName}, args...).Err()
+	if err != nil {
+		log.Printf("app registry update failed for %s: %v", appName, err)
+	}
+}
+
+func SetAppStatus(rds *redis.Client, appName, status string) {
+	UpdateApp(rds, appName, map[string]interface{}{"status": status})
+}
+
+// GetConfig returns the environment variables set for an app through the api.
+func GetConfig(rds *redis.Client, appName string) (map[string]string, error) {
+	return rds.HGetAll(context.Background(), "config:"+appName).Result()
+}
+
+// GetSettings returns the runtime options set for an app through the api.
+func GetSettings(rds *redis.Client, appName string) (models.Settings, error) {
+	var settings models.Settings
+	err := rds.HMGet(context.Background(), "app:"+appName,
+		"port", "replicas", "cpu", "memory",
+		"autoscale_min", "autoscale_max", "autoscale_cpu", "autoscale_memory",
+		"health_path", "health_port", "health_timeout", "health_threshold", "health_startup",
+	).Scan(&settings)
+	return settings, err
+}
+
+func RemoveApp(rds *redis.Client, appName string) {
+	ctx := context.Background()
+
+	// drop ownership and history too so a later app with the same name
+	// cannot inherit collaborators or roll back to these images
+	pipe := rds.TxPipeline()
+	pipe.Del(ctx, "app:"+appName, "app:"+appName+":collaborators", releasesKey(appName), "config:"+appName, "secrets:"+appName)
+	pipe.SRem(ctx, "apps", appName)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("app registry cleanup failed for %s: %v", appName, err)
+	}
+}
@@ -0,0 +1,60 @@
+package rediss
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// deletion:<app> outlives the app record so the outcome of a delete can
+// still be looked up through the api.
+const deletionTTL = 24 * time.Hour
+
+func deletionKey(appName string) string {
+	return "deletion:" + appName
+}
+
+// SetDeletionState moves the delete record of an app to state.
+func SetDeletionState(rds *redis.Client, appName string, state string) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	err := rds.HSet(ctx, deletionKey(appName),
+		"state", state,
+		state+"_at", now,
+		"updated_at", now,
+	).Err()
+	if err != nil {
+		log.Printf("deletion record update failed for %s: %v", appName, err)
+	}
+}
+
+// FinishDeletion stores the outcome of a delete. failed maps each resource
+// that could not be removed to its error.
+func FinishDeletion(rds *redis.Client, appName string, state string, removed []string, missing []string, failed map[string]string) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	failedJSON, err := json.Marshal(failed)
+	if err != nil {
+		failedJSON = []byte("{}")
+	}
+
+	pipe := rds.TxPipeline()
+	pipe.HSet(ctx, deletionKey(appName),
+		"state", state,
+		state+"_at", now,
+		"updated_at", now,
+		"removed", strings.Join(removed, ","),
+		"missing", strings.Join(missing, ","),
+		"failed", string(failedJSON),
+	)
+	pipe.Expire(ctx, deletionKey(appName), deletionTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("deletion record update failed for %s: %v", appName, err)
+	}
+}
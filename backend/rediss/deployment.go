@@ -0,0 +1,70 @@
+package rediss
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"minihiroku/backend/models"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func deploymentKey(depid string) string {
+	return "deployment:" + depid
+}
+
+// SetDeploymentState moves deployment:<depid> to a new state and stamps
+// <state>_at. Transitions not allowed by models.CanTransition are rejected so
+// a late step can never overwrite a terminal state.
+func SetDeploymentState(rds *redis.Client, depid, appName, state, reason string) error {
+	ctx := context.Background()
+	key := deploymentKey(depid)
+
+	return rds.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.HGet(ctx, key, "state").Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if current != "" && !models.CanTransition(current, state) {
+			return fmt.Errorf("deployment %s cannot move from %s to %s", depid, current, state)
+		}
+
+		now := time.Now().Unix()
+		fields := map[string]interface{}{
+			"depid":       depid,
+			"app":         appName,
+			"state":       state,
+			"updated_at":  now,
+			state + "_at": now,
+		}
+		if reason != "" {
+			fields["reason"] = reason
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSetNX(ctx, key, "created_at", now)
+			pipe.HSet(ctx, key, fields)
+			return nil
+		})
+		return err
+	}, key)
+}
+
+// SetDeploymentInfo records extra build facts such as the resolved commit on
+// deployment:<depid> without touching its state.
+func SetDeploymentInfo(rds *redis.Client, depid string, fields map[string]interface{}) {
+	if err := rds.HSet(context.Background(), deploymentKey(depid), fields).Err(); err != nil {
+		log.Printf("deployment update failed for %s: %v", depid, err)
+	}
+}
+
+// DeploymentState returns the current state of deployment:<depid>, "" when
+// it is unknown.
+func DeploymentState(rds *redis.Client, depid string) (string, error) {
+	state, err := rds.HGet(context.Background(), deploymentKey(depid), "state").Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return state, err
+}
@@ -0,0 +1,68 @@
+package rediss
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"minihiroku/backend/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// releases kept per app; older ones are trimmed off the list.
+const maxReleases = 50
+
+func releasesKey(appName string) string {
+	return "releases:" + appName
+}
+
+func AddRelease(rds *redis.Client, appName string, release models.Release) error {
+	ctx := context.Background()
+
+	data, err := json.Marshal(release)
+	if err != nil {
+		return err
+	}
+
+	pipe := rds.TxPipeline()
+	pipe.LPush(ctx, releasesKey(appName), data)
+	pipe.LTrim(ctx, releasesKey(appName), 0, maxReleases-1)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func GetRelease(rds *redis.Client, appName, depid string) (*models.Release, error) {
+	items, err := rds.LRange(context.Background(), releasesKey(appName), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		var release models.Release
+		if err := json.Unmarshal([]byte(item), &release); err != nil {
+			continue
+		}
+		if release.DepId == depid {
+			return &release, nil
+		}
+	}
+	return nil, fmt.Errorf("no release %s for app %s", depid, appName)
+}
+
+// LatestRelease returns the newest release of an app, the last image that
+// went live. It returns nil without an error when the app has none.
+func LatestRelease(rds *redis.Client, appName string) (*models.Release, error) {
+	item, err := rds.LIndex(context.Background(), releasesKey(appName), 0).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var release models.Release
+	if err := json.Unmarshal([]byte(item), &release); err != nil {
+		return nil, err
+	}
+	return &release, nil
+}
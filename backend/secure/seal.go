@@ -0,0 +1,48 @@
+package secure
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Open decrypts values sealed by the api with AES-GCM under SECRETS_KEY
+// (32 bytes, base64).
+func Open(sealed string) (map[string]string, error) {
+	key, err := base64.StdEncoding.DecodeString(os.Getenv("SECRETS_KEY"))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("SECRETS_KEY must be 32 base64 encoded bytes")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("sealed value too short")
+	}
+
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]string
+	if err := json.Unmarshal(plain, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
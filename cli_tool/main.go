@@ -13,41 +13,189 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"golang.org/x/term"
 )
 
 type CreatePayload struct {
-	GitRepo string `json:"gitrepo"`
-	UserId  string `json:"userid"`
-	AppName string `json:"appname"`
+	GitRepo   string `json:"gitrepo"`
+	UserId    string `json:"userid"`
+	AppName   string `json:"appname"`
+	Ref       string `json:"ref,omitempty"`
+	BuildMode string `json:"buildmode,omitempty"`
 }
 
 type DeletePayload struct {
 	UserId  string `json:"userid"`
 	AppName string `json:"appname"`
 	Force   bool   `json:"force"`
+	Drain   int    `json:"drain,omitempty"`
+}
+
+type AppInfo struct {
+	Name            string `json:"name"`
+	UserId          string `json:"userid"`
+	GitRepo         string `json:"gitrepo"`
+	DepID           string `json:"depid"`
+	URL             string `json:"url"`
+	Port            int    `json:"port"`
+	Replicas        string `json:"replicas"`
+	CPU             string `json:"cpu"`
+	Memory          string `json:"memory"`
+	AutoscaleMin    int    `json:"autoscale_min"`
+	AutoscaleMax    int    `json:"autoscale_max"`
+	AutoscaleCPU    int    `json:"autoscale_cpu"`
+	AutoscaleMemory int    `json:"autoscale_memory"`
+	HealthPath      string `json:"health_path"`
+	HealthPort      int    `json:"health_port"`
+	Status          string `json:"status"`
+	CreatedAt       int64  `json:"created_at"`
+	UpdatedAt       int64  `json:"updated_at"`
+}
+
+type DeploymentInfo struct {
+	DepID      string           `json:"depid"`
+	App        string           `json:"app"`
+	State      string           `json:"state"`
+	Reason     string           `json:"reason"`
+	Ref        string           `json:"ref"`
+	Commit     string           `json:"commit"`
+	BuildMode  string           `json:"build_mode"`
+	Digest     string           `json:"digest"`
+	Buildpacks []string         `json:"buildpacks"`
+	BuildTime  int64            `json:"build_duration"`
+	Timestamps map[string]int64 `json:"timestamps"`
+}
+
+type DeletionInfo struct {
+	App        string            `json:"app"`
+	State      string            `json:"state"`
+	Force      bool              `json:"force"`
+	Removed    []string          `json:"removed"`
+	Missing    []string          `json:"missing"`
+	Failed     map[string]string `json:"failed"`
+	Timestamps map[string]int64  `json:"timestamps"`
+}
+
+type RollbackPayload struct {
+	To string `json:"to,omitempty"`
+}
+
+type ReleaseInfo struct {
+	DepID      string `json:"depid"`
+	Image      string `json:"image"`
+	GitRepo    string `json:"gitrepo"`
+	Ref        string `json:"ref"`
+	Commit     string `json:"commit"`
+	UserId     string `json:"userid"`
+	Timestamp  int64  `json:"timestamp"`
+	RollbackOf string `json:"rollback_of"`
+}
+
+type CollaboratorPayload struct {
+	UserId string `json:"userid"`
+}
+
+type GitAuthPayload struct {
+	Type       string `json:"type"`
+	SSHKey     string `json:"ssh_key,omitempty"`
+	KnownHosts string `json:"known_hosts,omitempty"`
+	Username   string `json:"username,omitempty"`
+	Token      string `json:"token,omitempty"`
+}
+
+type ConfigVarsPayload struct {
+	Vars map[string]string `json:"vars"`
+}
+
+type ConfigKeysPayload struct {
+	Keys []string `json:"keys"`
+}
+
+type PortPayload struct {
+	Port int `json:"port"`
+}
+
+type ScalePayload struct {
+	Replicas int `json:"replicas"`
+}
+
+type ResizePayload struct {
+	CPU    string `json:"cpu,omitempty"`
+	Memory string `json:"memory,omitempty"`
+}
+
+type AutoscalePayload struct {
+	Min    int `json:"min"`
+	Max    int `json:"max"`
+	CPU    int `json:"cpu"`
+	Memory int `json:"memory"`
+}
+
+type HealthCheckPayload struct {
+	Path      string `json:"path,omitempty"`
+	Port      int    `json:"port,omitempty"`
+	Timeout   int    `json:"timeout,omitempty"`
+	Threshold int    `json:"threshold,omitempty"`
+	Startup   int    `json:"startup,omitempty"`
 }
 
 type ConfigPayload struct {
 	APIURL      string `json:"apiUrl"`
 	DatabaseURL string `json:"databaseUrl"`
 	UserID      string `json:"userID"`
+	Token       string `json:"token,omitempty"`
+}
+
+type LoginPayload struct {
+	UserId string `json:"userid"`
+}
+
+// apiToken is sent as the bearer token on every api call once logged in.
+var apiToken string
+
+func authHeader() http.Header {
+	header := http.Header{}
+	if apiToken != "" {
+		header.Set("Authorization", "Bearer "+apiToken)
+	}
+	return header
+}
+
+// apiError pulls the {"error": "..."} message out of a failed response.
+func apiError(resp *http.Response) error {
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err == nil && body.Error != "" {
+		return fmt.Errorf("%s (%s)", body.Error, resp.Status)
+	}
+	return fmt.Errorf("request failed with status %s", resp.Status)
+}
+
+// postJSON sends payload and, when out is not nil, decodes the response into it.
+func postJSON(url string, payload any, out any) error {
+	return sendJSON("POST", url, payload, out)
 }
 
-func postJSON(url string, payload any) error {
+func sendJSON(method string, url string, payload any, out any) error {
 	data, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(data))
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(data))
 	if err != nil {
 		return err
 	}
 
+	req.Header = authHeader()
 	req.Header.Set("Content-Type", "application/json")
 
 	client := &http.Client{Timeout: 10 * time.Second}
@@ -58,31 +206,77 @@ func postJSON(url string, payload any) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 300 {
-		return fmt.Errorf("request failed with status %s", resp.Status)
+		return apiError(resp)
 	}
 
-	return nil
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
 }
 
-func CreateResource(baseURL, userID, repo string, appname string) error {
+func getJSON(url string, out any) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header = authHeader()
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return apiError(resp)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func orDefault(value string, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+func formatTime(ts int64) string {
+	if ts == 0 {
+		return "-"
+	}
+	return time.Unix(ts, 0).Format("2006-01-02 15:04:05")
+}
+
+// CreateResource queues a deployment and returns its deployment ID.
+func CreateResource(baseURL, userID, repo string, appname string, ref string, buildMode string) (string, error) {
 	payload := CreatePayload{
-		GitRepo: repo,
-		UserId:  userID,
-		AppName: appname,
+		GitRepo:   repo,
+		UserId:    userID,
+		AppName:   appname,
+		Ref:       ref,
+		BuildMode: buildMode,
 	}
 
+	var res struct {
+		DepID string `json:"depid"`
+	}
 	url := strings.TrimSuffix(baseURL, "/") + "/create"
-	return postJSON(url, payload)
+	err := postJSON(url, payload, &res)
+	return res.DepID, err
 }
 
-func DeleteResource(baseURL, userID, appname string, force bool) error {
+func DeleteResource(baseURL, userID, appname string, force bool, drain int) error {
 	payload := DeletePayload{
 		UserId:  userID,
 		AppName: appname,
 		Force:   force,
+		Drain:   drain,
 	}
 	url := strings.TrimSuffix(baseURL, "/") + "/delete"
-	return postJSON(url, payload)
+	return postJSON(url, payload, nil)
 }
 
 func askInput(reader *bufio.Reader, question string) string {
@@ -127,27 +321,34 @@ func RunConfigSetup() {
 		UserID:      userid,
 	}
 
+	if err := SaveConfig(cfg); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Printf("Config saved to %s\n", getConfigPath())
+	fmt.Printf("Generated User ID: %s\n", userid)
+	fmt.Println("Run 'mycli login' to get an API token.")
+}
+
+func SaveConfig(cfg ConfigPayload) error {
 	path := getConfigPath()
 	dir := filepath.Dir(path)
 
 	if err := os.MkdirAll(dir, 0755); err != nil {
-		fmt.Printf("Error creating directory: %v\n", err)
-		return
+		return fmt.Errorf("Error creating directory: %v", err)
 	}
 
 	data, err := json.MarshalIndent(cfg, "", "  ")
 	if err != nil {
-		fmt.Printf("Error marshaling config: %v\n", err)
-		return
+		return fmt.Errorf("Error marshaling config: %v", err)
 	}
 
-	if err := os.WriteFile(path, data, 0644); err != nil {
-		fmt.Printf("Error writing config file: %v\n", err)
-		return
+	// the file holds the api token, keep it private
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("Error writing config file: %v", err)
 	}
-
-	fmt.Printf("Config saved to %s\n", path)
-	fmt.Printf("Generated User ID: %s\n", userid)
+	return nil
 }
 
 func LoadConfig() (ConfigPayload, error) {
@@ -192,7 +393,7 @@ func HandleLogs(cfg ConfigPayload) {
 	fmt.Printf("Connecting to log stream for %s at %s...\n", *app, u.String())
 
 	// 2. Connect to WebSocket
-	c, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	c, _, err := websocket.DefaultDialer.Dial(u.String(), authHeader())
 	if err != nil {
 		log.Fatal("dial:", err)
 	}
@@ -241,30 +442,97 @@ func HandleLogs(cfg ConfigPayload) {
 
 func HandleCLI(cfg ConfigPayload) {
 	if len(os.Args) < 2 {
-		fmt.Println("Expected 'create' or 'delete' or 'logs' subcommand")
+		fmt.Println("Expected 'login', 'create', 'delete', 'logs', 'apps', 'status', 'releases', 'rollback', 'cancel', 'collaborators', 'gitauth', 'config', 'secrets', 'port', 'scale', 'resize', 'autoscale' or 'healthcheck' subcommand")
 		os.Exit(1)
 	}
 
 	switch os.Args[1] {
+	case "login":
+		HandleLogin(cfg)
 	case "create":
 		HandleCreate(cfg)
 	case "delete":
 		HandleDelete(cfg)
 	case "logs":
 		HandleLogs(cfg)
+	case "apps":
+		HandleApps(cfg)
+	case "status":
+		HandleStatus(cfg)
+	case "releases":
+		HandleReleases(cfg)
+	case "rollback":
+		HandleRollback(cfg)
+	case "cancel":
+		HandleCancel(cfg)
+	case "collaborators":
+		HandleCollaborators(cfg)
+	case "gitauth":
+		HandleGitAuth(cfg)
+	case "config":
+		HandleAppConfig(cfg)
+	case "secrets":
+		HandleSecrets(cfg)
+	case "port":
+		HandlePort(cfg)
+	case "scale":
+		HandleScale(cfg)
+	case "resize":
+		HandleResize(cfg)
+	case "autoscale":
+		HandleAutoscale(cfg)
+	case "healthcheck":
+		HandleHealthCheck(cfg)
 	default:
 		if os.Args[1] == "-config" || os.Args[1] == "--config" {
 			return
 		}
 		fmt.Println("Unknown command:", os.Args[1])
-		fmt.Println("Usage: mycli [create|delete] [flags]")
+		fmt.Println("Usage: mycli [login|create|delete|logs|apps|status|releases|rollback|cancel|collaborators|gitauth|config|secrets|port|scale|resize|autoscale|healthcheck] [flags]")
 	}
 }
 
+func HandleLogin(cfg ConfigPayload) {
+	loginCmd := flag.NewFlagSet("login", flag.ExitOnError)
+	user := loginCmd.String("user", cfg.UserID, "User ID to log in as")
+	token := loginCmd.String("token", "", "Use an existing API token instead of requesting one")
+
+	loginCmd.Parse(os.Args[2:])
+
+	if *user == "" {
+		fmt.Println("Error: missing -user flag")
+		loginCmd.PrintDefaults()
+		return
+	}
+
+	if *token == "" {
+		var res struct {
+			Token string `json:"token"`
+		}
+		u := strings.TrimSuffix(cfg.APIURL, "/") + "/login"
+		if err := postJSON(u, LoginPayload{UserId: *user}, &res); err != nil {
+			fmt.Println("Login failed:", err)
+			return
+		}
+		*token = res.Token
+	}
+
+	cfg.UserID = *user
+	cfg.Token = *token
+	if err := SaveConfig(cfg); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Printf("Logged in as %s. Token saved to %s\n", cfg.UserID, getConfigPath())
+}
+
 func HandleCreate(cfg ConfigPayload) {
 	createCmd := flag.NewFlagSet("create", flag.ExitOnError)
 	repo := createCmd.String("repo", "", "Github repo ID or URL")
 	appname := createCmd.String("app", "", "appname")
+	ref := createCmd.String("ref", "", "Branch, tag or commit SHA to build (default: repo default branch)")
+	buildMode := createCmd.String("buildmode", "auto", "How to build: auto (Dockerfile if the repo has one), buildpacks or dockerfile")
 
 	createCmd.Parse(os.Args[2:])
 
@@ -281,19 +549,30 @@ func HandleCreate(cfg ConfigPayload) {
 
 	fmt.Printf("Deploying repo: %s , %s for user: %s...\n", *repo, *appname, cfg.UserID)
 
-	err := CreateResource(cfg.APIURL, cfg.UserID, *repo, *appname)
+	if *ref != "" {
+		fmt.Printf("Using ref: %s\n", *ref)
+	}
+
+	if *buildMode != "auto" {
+		fmt.Printf("Build mode: %s\n", *buildMode)
+	}
+
+	depid, err := CreateResource(cfg.APIURL, cfg.UserID, *repo, *appname, *ref, *buildMode)
 	if err != nil {
 		fmt.Println("Create failed:", err)
 		return
 	}
 
 	fmt.Println("Create success!")
+	fmt.Printf("Deployment ID: %s\n", depid)
 }
 
 func HandleDelete(cfg ConfigPayload) {
 	deleteCmd := flag.NewFlagSet("delete", flag.ExitOnError)
 	force := deleteCmd.Bool("force", false, "Force delete (no graceful shutdown)")
+	drain := deleteCmd.Int("drain", 0, "Seconds to let in-flight requests finish after traffic stops (0 = server default)")
 	app := deleteCmd.String("app", "", "App ID to delete")
+	status := deleteCmd.Bool("status", false, "Show how the last delete of the app went")
 
 	deleteCmd.Parse(os.Args[2:])
 
@@ -303,21 +582,728 @@ func HandleDelete(cfg ConfigPayload) {
 		return
 	}
 
+	if *status {
+		ShowDeletion(cfg, *app)
+		return
+	}
+
 	fmt.Printf("Deleting app: %s for user: %s...\n", *app, cfg.UserID)
 
 	if *force {
-		fmt.Println("⚠️ Force delete enabled: active connections may be dropped")
+		fmt.Println("⚠️ Force delete enabled: pods are killed immediately and running builds cancelled")
 	} else {
 		fmt.Println("Graceful delete: draining traffic before shutdown")
 	}
 
-	err := DeleteResource(cfg.APIURL, cfg.UserID, *app, *force)
+	err := DeleteResource(cfg.APIURL, cfg.UserID, *app, *force, *drain)
 	if err != nil {
 		fmt.Println("Delete failed:", err)
 		return
 	}
 
-	fmt.Println("Delete success!")
+	fmt.Println("Delete queued. Check the outcome with: mycli delete -app " + *app + " -status")
+}
+
+func ShowDeletion(cfg ConfigPayload, app string) {
+	var del DeletionInfo
+	u := strings.TrimSuffix(cfg.APIURL, "/") + "/apps/" + url.PathEscape(app) + "/deletion"
+	if err := getJSON(u, &del); err != nil {
+		fmt.Println("Delete status failed:", err)
+		return
+	}
+
+	fmt.Printf("App:        %s\n", del.App)
+	fmt.Printf("State:      %s\n", del.State)
+	fmt.Printf("Force:      %t\n", del.Force)
+	fmt.Printf("Removed:    %s\n", orDefault(strings.Join(del.Removed, ", "), "-"))
+	fmt.Printf("Missing:    %s\n", orDefault(strings.Join(del.Missing, ", "), "-"))
+	resources := make([]string, 0, len(del.Failed))
+	for resource := range del.Failed {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	for _, resource := range resources {
+		fmt.Printf("Failed:     %s: %s\n", resource, del.Failed[resource])
+	}
+	for _, state := range []string{"queued", "deleting", "deleted", "failed"} {
+		if ts, ok := del.Timestamps[state]; ok {
+			fmt.Printf("  %-10s %s\n", state, formatTime(ts))
+		}
+	}
+}
+
+func HandleApps(cfg ConfigPayload) {
+	appsCmd := flag.NewFlagSet("apps", flag.ExitOnError)
+
+	appsCmd.Parse(os.Args[2:])
+
+	u := strings.TrimSuffix(cfg.APIURL, "/") + "/apps"
+
+	var res struct {
+		Apps []AppInfo `json:"apps"`
+	}
+	if err := getJSON(u, &res); err != nil {
+		fmt.Println("Listing apps failed:", err)
+		return
+	}
+
+	if len(res.Apps) == 0 {
+		fmt.Println("No apps found.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATUS\tDEPID\tURL\tUPDATED")
+	for _, app := range res.Apps {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", app.Name, app.Status, app.DepID, app.URL, formatTime(app.UpdatedAt))
+	}
+	w.Flush()
+}
+
+func HandleStatus(cfg ConfigPayload) {
+	statusCmd := flag.NewFlagSet("status", flag.ExitOnError)
+	app := statusCmd.String("app", "", "App name to show")
+
+	statusCmd.Parse(os.Args[2:])
+
+	if *app == "" {
+		fmt.Println("Error: missing -app flag")
+		statusCmd.PrintDefaults()
+		return
+	}
+
+	var info AppInfo
+	u := strings.TrimSuffix(cfg.APIURL, "/") + "/apps/" + url.PathEscape(*app)
+	if err := getJSON(u, &info); err != nil {
+		fmt.Println("Status failed:", err)
+		return
+	}
+
+	fmt.Printf("App:        %s\n", info.Name)
+	fmt.Printf("Status:     %s\n", info.Status)
+	fmt.Printf("Deployment: %s\n", info.DepID)
+	fmt.Printf("Repo:       %s\n", info.GitRepo)
+	fmt.Printf("URL:        %s\n", info.URL)
+	if info.Port != 0 {
+		fmt.Printf("Port:       %d\n", info.Port)
+	} else {
+		fmt.Printf("Port:       auto\n")
+	}
+	if info.AutoscaleMax != 0 {
+		fmt.Printf("Replicas:   autoscaling %d-%d (cpu %d%%, memory %d%%)\n", info.AutoscaleMin, info.AutoscaleMax, info.AutoscaleCPU, info.AutoscaleMemory)
+	} else {
+		fmt.Printf("Replicas:   %s\n", orDefault(info.Replicas, "default"))
+	}
+	fmt.Printf("Size:       %s cpu / %s memory\n", orDefault(info.CPU, "default"), orDefault(info.Memory, "default"))
+	if info.HealthPath != "" {
+		fmt.Printf("Health:     GET %s\n", info.HealthPath)
+	} else {
+		fmt.Printf("Health:     port check\n")
+	}
+	fmt.Printf("Owner:      %s\n", info.UserId)
+	fmt.Printf("Created:    %s\n", formatTime(info.CreatedAt))
+	fmt.Printf("Updated:    %s\n", formatTime(info.UpdatedAt))
+
+	if info.DepID == "" {
+		return
+	}
+
+	var dep DeploymentInfo
+	u = strings.TrimSuffix(cfg.APIURL, "/") + "/deployments/" + url.PathEscape(info.DepID)
+	if err := getJSON(u, &dep); err != nil {
+		fmt.Println("Deployment lookup failed:", err)
+		return
+	}
+
+	fmt.Printf("State:      %s\n", dep.State)
+	if dep.Ref != "" {
+		fmt.Printf("Ref:        %s\n", dep.Ref)
+	}
+	if dep.Commit != "" {
+		fmt.Printf("Commit:     %s\n", dep.Commit)
+	}
+	if dep.Digest != "" {
+		fmt.Printf("Image:      %s (%s build, %ds)\n", dep.Digest, orDefault(dep.BuildMode, "buildpacks"), dep.BuildTime)
+	}
+	if len(dep.Buildpacks) > 0 {
+		fmt.Printf("Buildpacks: %s\n", strings.Join(dep.Buildpacks, ", "))
+	}
+	if dep.Reason != "" {
+		fmt.Printf("Reason:     %s\n", dep.Reason)
+	}
+	for _, state := range []string{"queued", "cloning", "building", "pushing", "deploying", "routing", "live", "failed", "cancelled"} {
+		if ts, ok := dep.Timestamps[state]; ok {
+			fmt.Printf("  %-10s %s\n", state, formatTime(ts))
+		}
+	}
+}
+
+func HandleReleases(cfg ConfigPayload) {
+	releasesCmd := flag.NewFlagSet("releases", flag.ExitOnError)
+	app := releasesCmd.String("app", "", "App name to list releases for")
+
+	releasesCmd.Parse(os.Args[2:])
+
+	if *app == "" {
+		fmt.Println("Error: missing -app flag")
+		releasesCmd.PrintDefaults()
+		return
+	}
+
+	var res struct {
+		Releases []ReleaseInfo `json:"releases"`
+	}
+	u := strings.TrimSuffix(cfg.APIURL, "/") + "/apps/" + url.PathEscape(*app) + "/releases"
+	if err := getJSON(u, &res); err != nil {
+		fmt.Println("Listing releases failed:", err)
+		return
+	}
+
+	if len(res.Releases) == 0 {
+		fmt.Println("No releases found.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DEPID\tIMAGE\tREF\tCOMMIT\tUSER\tDEPLOYED\tNOTE")
+	for _, r := range res.Releases {
+		note := ""
+		if r.RollbackOf != "" {
+			note = "rollback to " + r.RollbackOf
+		}
+		commit := r.Commit
+		if len(commit) > 7 {
+			commit = commit[:7]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.DepID, r.Image, r.Ref, commit, r.UserId, formatTime(r.Timestamp), note)
+	}
+	w.Flush()
+}
+
+func HandleRollback(cfg ConfigPayload) {
+	rollbackCmd := flag.NewFlagSet("rollback", flag.ExitOnError)
+	app := rollbackCmd.String("app", "", "App name to roll back")
+	to := rollbackCmd.String("to", "", "Deployment ID to roll back to (default: previous release)")
+
+	rollbackCmd.Parse(os.Args[2:])
+
+	if *app == "" {
+		fmt.Println("Error: missing -app flag")
+		rollbackCmd.PrintDefaults()
+		return
+	}
+
+	var res struct {
+		DepID  string `json:"depid"`
+		Target string `json:"target"`
+		Image  string `json:"image"`
+	}
+	u := strings.TrimSuffix(cfg.APIURL, "/") + "/apps/" + url.PathEscape(*app) + "/rollback"
+	err := postJSON(u, RollbackPayload{To: *to}, &res)
+	if err != nil {
+		fmt.Println("Rollback failed:", err)
+		return
+	}
+
+	fmt.Printf("Rolling back %s to %s (%s)\n", *app, res.Target, res.Image)
+	fmt.Printf("Deployment ID: %s\n", res.DepID)
+}
+
+// HandleCancel stops the build of an app's current deployment, or of the
+// one given with -depid.
+func HandleCancel(cfg ConfigPayload) {
+	cancelCmd := flag.NewFlagSet("cancel", flag.ExitOnError)
+	app := cancelCmd.String("app", "", "App whose build to cancel")
+	depid := cancelCmd.String("depid", "", "Deployment ID to cancel (default: the app's current deployment)")
+
+	cancelCmd.Parse(os.Args[2:])
+
+	if *app == "" && *depid == "" {
+		fmt.Println("Error: missing -app flag")
+		cancelCmd.PrintDefaults()
+		return
+	}
+
+	if *depid == "" {
+		var info AppInfo
+		u := strings.TrimSuffix(cfg.APIURL, "/") + "/apps/" + url.PathEscape(*app)
+		if err := getJSON(u, &info); err != nil {
+			fmt.Println("Cancel failed:", err)
+			return
+		}
+		if info.DepID == "" {
+			fmt.Println("Cancel failed: app has no deployment")
+			return
+		}
+		*depid = info.DepID
+	}
+
+	u := strings.TrimSuffix(cfg.APIURL, "/") + "/deployments/" + url.PathEscape(*depid) + "/cancel"
+	if err := postJSON(u, struct{}{}, nil); err != nil {
+		fmt.Println("Cancel failed:", err)
+		return
+	}
+
+	fmt.Printf("Cancelling deployment %s\n", *depid)
+	if *app != "" {
+		fmt.Println("Check the outcome with: mycli status -app " + *app)
+	}
+}
+
+func HandleCollaborators(cfg ConfigPayload) {
+	collabCmd := flag.NewFlagSet("collaborators", flag.ExitOnError)
+	app := collabCmd.String("app", "", "App name")
+	add := collabCmd.String("add", "", "User ID to grant access to")
+	remove := collabCmd.String("remove", "", "User ID to revoke access from")
+
+	collabCmd.Parse(os.Args[2:])
+
+	if *app == "" {
+		fmt.Println("Error: missing -app flag")
+		collabCmd.PrintDefaults()
+		return
+	}
+
+	u := strings.TrimSuffix(cfg.APIURL, "/") + "/apps/" + url.PathEscape(*app) + "/collaborators"
+
+	if *add != "" {
+		if err := postJSON(u, CollaboratorPayload{UserId: *add}, nil); err != nil {
+			fmt.Println("Adding collaborator failed:", err)
+			return
+		}
+		fmt.Printf("%s can now manage %s\n", *add, *app)
+	}
+	if *remove != "" {
+		if err := sendJSON("DELETE", u+"/"+url.PathEscape(*remove), struct{}{}, nil); err != nil {
+			fmt.Println("Removing collaborator failed:", err)
+			return
+		}
+		fmt.Printf("%s no longer has access to %s\n", *remove, *app)
+	}
+
+	var res struct {
+		Owner         string   `json:"owner"`
+		Collaborators []string `json:"collaborators"`
+	}
+	if err := getJSON(u, &res); err != nil {
+		fmt.Println("Listing collaborators failed:", err)
+		return
+	}
+
+	fmt.Printf("Owner:         %s\n", res.Owner)
+	fmt.Printf("Collaborators: %s\n", strings.Join(res.Collaborators, ", "))
+}
+
+func HandleGitAuth(cfg ConfigPayload) {
+	gitCmd := flag.NewFlagSet("gitauth", flag.ExitOnError)
+	app := gitCmd.String("app", "", "App name")
+	sshKey := gitCmd.String("ssh-key", "", "Path to a deploy SSH private key")
+	knownHosts := gitCmd.String("known-hosts", "", "Path to a known_hosts file for the git server")
+	tokenStdin := gitCmd.Bool("token-stdin", false, "Read an HTTPS access token from stdin")
+	username := gitCmd.String("username", "", "Username sent with the token (default: git)")
+	remove := gitCmd.Bool("remove", false, "Remove the registered credentials")
+
+	gitCmd.Parse(os.Args[2:])
+
+	if *app == "" {
+		fmt.Println("Error: missing -app flag")
+		gitCmd.PrintDefaults()
+		return
+	}
+
+	u := strings.TrimSuffix(cfg.APIURL, "/") + "/apps/" + url.PathEscape(*app) + "/gitauth"
+
+	switch {
+	case *remove:
+		if err := sendJSON("DELETE", u, struct{}{}, nil); err != nil {
+			fmt.Println("Removing git credentials failed:", err)
+			return
+		}
+		fmt.Println("Git credentials removed.")
+
+	case *sshKey != "":
+		key, err := os.ReadFile(*sshKey)
+		if err != nil {
+			fmt.Println("Reading SSH key failed:", err)
+			return
+		}
+		payload := GitAuthPayload{Type: "ssh", SSHKey: string(key)}
+		if *knownHosts != "" {
+			hosts, err := os.ReadFile(*knownHosts)
+			if err != nil {
+				fmt.Println("Reading known_hosts failed:", err)
+				return
+			}
+			payload.KnownHosts = string(hosts)
+		}
+		if err := postJSON(u, payload, nil); err != nil {
+			fmt.Println("Saving git credentials failed:", err)
+			return
+		}
+		fmt.Println("Deploy key registered.")
+
+	case *tokenStdin:
+		fmt.Fprintln(os.Stderr, "Enter access token:")
+		token, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && token == "" {
+			fmt.Println("Reading token failed:", err)
+			return
+		}
+		payload := GitAuthPayload{Type: "token", Token: strings.TrimSpace(token), Username: *username}
+		if err := postJSON(u, payload, nil); err != nil {
+			fmt.Println("Saving git credentials failed:", err)
+			return
+		}
+		fmt.Println("Access token registered.")
+
+	default:
+		var res struct {
+			Configured bool   `json:"configured"`
+			Type       string `json:"type"`
+		}
+		if err := getJSON(u, &res); err != nil {
+			fmt.Println("Checking git credentials failed:", err)
+			return
+		}
+		if !res.Configured {
+			fmt.Println("No git credentials registered.")
+			return
+		}
+		fmt.Printf("Git credentials registered (%s).\n", res.Type)
+	}
+}
+
+// HandleAppConfig manages app environment variables:
+// config set -app X KEY=VALUE..., config unset -app X KEY..., config list -app X
+func HandleAppConfig(cfg ConfigPayload) {
+	if len(os.Args) < 3 {
+		fmt.Println("Expected 'set', 'unset' or 'list'")
+		return
+	}
+	action := os.Args[2]
+
+	configCmd := flag.NewFlagSet("config "+action, flag.ExitOnError)
+	app := configCmd.String("app", "", "App name")
+
+	configCmd.Parse(os.Args[3:])
+
+	if *app == "" {
+		fmt.Println("Error: missing -app flag")
+		configCmd.PrintDefaults()
+		return
+	}
+
+	u := strings.TrimSuffix(cfg.APIURL, "/") + "/apps/" + url.PathEscape(*app) + "/config"
+
+	switch action {
+	case "set":
+		vars := map[string]string{}
+		for _, arg := range configCmd.Args() {
+			key, value, ok := strings.Cut(arg, "=")
+			if !ok || key == "" {
+				fmt.Printf("Error: %q is not KEY=VALUE\n", arg)
+				return
+			}
+			vars[key] = value
+		}
+		if len(vars) == 0 {
+			fmt.Println("Error: nothing to set, pass KEY=VALUE pairs")
+			return
+		}
+		if err := postJSON(u, ConfigVarsPayload{Vars: vars}, nil); err != nil {
+			fmt.Println("Setting config failed:", err)
+			return
+		}
+		fmt.Printf("Set %d var(s) on %s, app will restart with the new config.\n", len(vars), *app)
+
+	case "unset":
+		keys := configCmd.Args()
+		if len(keys) == 0 {
+			fmt.Println("Error: nothing to unset, pass KEY names")
+			return
+		}
+		if err := sendJSON("DELETE", u, ConfigKeysPayload{Keys: keys}, nil); err != nil {
+			fmt.Println("Unsetting config failed:", err)
+			return
+		}
+		fmt.Printf("Unset %d var(s) on %s, app will restart with the new config.\n", len(keys), *app)
+
+	case "list":
+		var res struct {
+			Vars map[string]string `json:"vars"`
+		}
+		if err := getJSON(u, &res); err != nil {
+			fmt.Println("Listing config failed:", err)
+			return
+		}
+		if len(res.Vars) == 0 {
+			fmt.Println("No config vars set.")
+			return
+		}
+		keys := make([]string, 0, len(res.Vars))
+		for key := range res.Vars {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Printf("%s=%s\n", key, res.Vars[key])
+		}
+
+	default:
+		fmt.Println("Unknown config action:", action)
+		fmt.Println("Expected 'set', 'unset' or 'list'")
+	}
+}
+
+// readSecret reads a secret value from stdin without echoing it when stdin
+// is a terminal, so it never shows up in shell history or ps output.
+func readSecret(key string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		fmt.Fprintf(os.Stderr, "Enter value for %s: ", key)
+		value, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(value), err
+	}
+
+	value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && value == "" {
+		return "", err
+	}
+	return strings.TrimRight(value, "\r\n"), nil
+}
+
+// HandleSecrets manages encrypted app secrets:
+// secrets set -app X KEY (value read from stdin), secrets unset -app X KEY...,
+// secrets list -app X. Values are never printed.
+func HandleSecrets(cfg ConfigPayload) {
+	if len(os.Args) < 3 {
+		fmt.Println("Expected 'set', 'unset' or 'list'")
+		return
+	}
+	action := os.Args[2]
+
+	secretsCmd := flag.NewFlagSet("secrets "+action, flag.ExitOnError)
+	app := secretsCmd.String("app", "", "App name")
+
+	secretsCmd.Parse(os.Args[3:])
+
+	if *app == "" {
+		fmt.Println("Error: missing -app flag")
+		secretsCmd.PrintDefaults()
+		return
+	}
+
+	u := strings.TrimSuffix(cfg.APIURL, "/") + "/apps/" + url.PathEscape(*app) + "/secrets"
+
+	switch action {
+	case "set":
+		if secretsCmd.NArg() != 1 {
+			fmt.Println("Error: pass exactly one secret name, the value is read from stdin")
+			return
+		}
+		key := secretsCmd.Arg(0)
+		value, err := readSecret(key)
+		if err != nil {
+			fmt.Println("Reading secret failed:", err)
+			return
+		}
+		if err := postJSON(u, ConfigVarsPayload{Vars: map[string]string{key: value}}, nil); err != nil {
+			fmt.Println("Setting secret failed:", err)
+			return
+		}
+		fmt.Printf("Secret %s set on %s, app will restart with the new secrets.\n", key, *app)
+
+	case "unset":
+		keys := secretsCmd.Args()
+		if len(keys) == 0 {
+			fmt.Println("Error: nothing to unset, pass secret names")
+			return
+		}
+		if err := sendJSON("DELETE", u, ConfigKeysPayload{Keys: keys}, nil); err != nil {
+			fmt.Println("Unsetting secrets failed:", err)
+			return
+		}
+		fmt.Printf("Unset %d secret(s) on %s, app will restart with the new secrets.\n", len(keys), *app)
+
+	case "list":
+		var res struct {
+			Keys []string `json:"keys"`
+		}
+		if err := getJSON(u, &res); err != nil {
+			fmt.Println("Listing secrets failed:", err)
+			return
+		}
+		if len(res.Keys) == 0 {
+			fmt.Println("No secrets set.")
+			return
+		}
+		for _, key := range res.Keys {
+			fmt.Println(key)
+		}
+
+	default:
+		fmt.Println("Unknown secrets action:", action)
+		fmt.Println("Expected 'set', 'unset' or 'list'")
+	}
+}
+
+// HandlePort sets the port an app listens on: port -app X 3000. Passing
+// "auto" goes back to the PORT config var or the 8080 default.
+func HandlePort(cfg ConfigPayload) {
+	portCmd := flag.NewFlagSet("port", flag.ExitOnError)
+	app := portCmd.String("app", "", "App name")
+
+	portCmd.Parse(os.Args[2:])
+
+	if *app == "" || portCmd.NArg() != 1 {
+		fmt.Println("Usage: mycli port -app <name> <port|auto>")
+		portCmd.PrintDefaults()
+		return
+	}
+
+	port := 0
+	if portCmd.Arg(0) != "auto" {
+		n, err := strconv.Atoi(portCmd.Arg(0))
+		if err != nil || n < 1 || n > 65535 {
+			fmt.Printf("Error: %q is not a valid port\n", portCmd.Arg(0))
+			return
+		}
+		port = n
+	}
+
+	u := strings.TrimSuffix(cfg.APIURL, "/") + "/apps/" + url.PathEscape(*app) + "/port"
+	if err := postJSON(u, PortPayload{Port: port}, nil); err != nil {
+		fmt.Println("Setting port failed:", err)
+		return
+	}
+	if port == 0 {
+		fmt.Printf("Port of %s reset to auto.\n", *app)
+		return
+	}
+	fmt.Printf("%s will listen on port %d.\n", *app, port)
+}
+
+func HandleScale(cfg ConfigPayload) {
+	scaleCmd := flag.NewFlagSet("scale", flag.ExitOnError)
+	app := scaleCmd.String("app", "", "App name")
+	replicas := scaleCmd.Int("replicas", -1, "Number of replicas")
+
+	scaleCmd.Parse(os.Args[2:])
+
+	if *app == "" || *replicas < 0 {
+		fmt.Println("Error: missing -app or -replicas flag")
+		scaleCmd.PrintDefaults()
+		return
+	}
+
+	u := strings.TrimSuffix(cfg.APIURL, "/") + "/apps/" + url.PathEscape(*app) + "/scale"
+	if err := postJSON(u, ScalePayload{Replicas: *replicas}, nil); err != nil {
+		fmt.Println("Scaling failed:", err)
+		return
+	}
+	fmt.Printf("Scaling %s to %d replica(s).\n", *app, *replicas)
+}
+
+func HandleResize(cfg ConfigPayload) {
+	resizeCmd := flag.NewFlagSet("resize", flag.ExitOnError)
+	app := resizeCmd.String("app", "", "App name")
+	cpu := resizeCmd.String("cpu", "", "CPU limit (250m, 500m, 1, 2)")
+	memory := resizeCmd.String("memory", "", "Memory limit (256Mi, 512Mi, 1Gi, 2Gi, 4Gi)")
+
+	resizeCmd.Parse(os.Args[2:])
+
+	if *app == "" || (*cpu == "" && *memory == "") {
+		fmt.Println("Error: missing -app flag or nothing to resize, pass -cpu and/or -memory")
+		resizeCmd.PrintDefaults()
+		return
+	}
+
+	u := strings.TrimSuffix(cfg.APIURL, "/") + "/apps/" + url.PathEscape(*app) + "/resize"
+	if err := postJSON(u, ResizePayload{CPU: *cpu, Memory: *memory}, nil); err != nil {
+		fmt.Println("Resizing failed:", err)
+		return
+	}
+	fmt.Printf("Resizing %s, app will restart with the new size.\n", *app)
+}
+
+func HandleAutoscale(cfg ConfigPayload) {
+	autoCmd := flag.NewFlagSet("autoscale", flag.ExitOnError)
+	app := autoCmd.String("app", "", "App name")
+	minReplicas := autoCmd.Int("min", 1, "Minimum replicas")
+	maxReplicas := autoCmd.Int("max", 0, "Maximum replicas")
+	cpu := autoCmd.Int("cpu", 0, "Target average CPU utilization in percent")
+	memory := autoCmd.Int("memory", 0, "Target average memory utilization in percent")
+	off := autoCmd.Bool("off", false, "Disable autoscaling")
+
+	autoCmd.Parse(os.Args[2:])
+
+	if *app == "" {
+		fmt.Println("Error: missing -app flag")
+		autoCmd.PrintDefaults()
+		return
+	}
+
+	u := strings.TrimSuffix(cfg.APIURL, "/") + "/apps/" + url.PathEscape(*app) + "/autoscale"
+
+	if *off {
+		if err := sendJSON("DELETE", u, struct{}{}, nil); err != nil {
+			fmt.Println("Disabling autoscaling failed:", err)
+			return
+		}
+		fmt.Println("Autoscaling disabled.")
+		return
+	}
+
+	if *maxReplicas == 0 || (*cpu == 0 && *memory == 0) {
+		fmt.Println("Error: pass -max and a -cpu and/or -memory target")
+		autoCmd.PrintDefaults()
+		return
+	}
+
+	payload := AutoscalePayload{Min: *minReplicas, Max: *maxReplicas, CPU: *cpu, Memory: *memory}
+	if err := postJSON(u, payload, nil); err != nil {
+		fmt.Println("Enabling autoscaling failed:", err)
+		return
+	}
+	fmt.Printf("Autoscaling %s between %d and %d replicas.\n", *app, *minReplicas, *maxReplicas)
+}
+
+func HandleHealthCheck(cfg ConfigPayload) {
+	healthCmd := flag.NewFlagSet("healthcheck", flag.ExitOnError)
+	app := healthCmd.String("app", "", "App name")
+	path := healthCmd.String("path", "", "HTTP path to probe, e.g. /healthz (default: port check only)")
+	port := healthCmd.Int("port", 0, "Port to probe (default: app port)")
+	timeout := healthCmd.Int("timeout", 0, "Probe timeout in seconds (default 1)")
+	threshold := healthCmd.Int("threshold", 0, "Failures before a pod counts as unhealthy (default 3)")
+	startup := healthCmd.Int("startup", 0, "Seconds the app may take to start (default 120)")
+	reset := healthCmd.Bool("reset", false, "Go back to the default port check")
+
+	healthCmd.Parse(os.Args[2:])
+
+	if *app == "" {
+		fmt.Println("Error: missing -app flag")
+		healthCmd.PrintDefaults()
+		return
+	}
+
+	u := strings.TrimSuffix(cfg.APIURL, "/") + "/apps/" + url.PathEscape(*app) + "/healthcheck"
+
+	if *reset {
+		if err := sendJSON("DELETE", u, struct{}{}, nil); err != nil {
+			fmt.Println("Resetting health checks failed:", err)
+			return
+		}
+		fmt.Println("Health checks reset to the default port check.")
+		return
+	}
+
+	payload := HealthCheckPayload{Path: *path, Port: *port, Timeout: *timeout, Threshold: *threshold, Startup: *startup}
+	if err := postJSON(u, payload, nil); err != nil {
+		fmt.Println("Setting health checks failed:", err)
+		return
+	}
+	fmt.Printf("Health checks updated for %s.\n", *app)
 }
 
 func main() {
@@ -337,5 +1323,6 @@ func main() {
 		os.Exit(1)
 	}
 
+	apiToken = cfg.Token
 	HandleCLI(cfg)
 }
@@ -9,6 +9,9 @@ import (
 	"math/big"
 	"net/http"
 	"os"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -48,17 +51,46 @@ func NewRedis(ip string, pass string) *redis.Client {
 	return rdb
 }
 
+// create queues a build and deploy. BuildMode picks buildpacks or the
+// repo's Dockerfile; empty or "auto" uses the Dockerfile when there is one.
 type create struct {
-	GitRepo string `json:"gitrepo"`
-	AppName string `json:"appname"`
-	UserId  string `json:"userid"`
-	DepID   string `json:"depid"`
+	GitRepo   string `json:"gitrepo"`
+	AppName   string `json:"appname"`
+	UserId    string `json:"userid"`
+	DepID     string `json:"depid"`
+	Ref       string `json:"ref"`
+	BuildMode string `json:"buildmode,omitempty"`
 }
 
+var buildModes = []string{"", "auto", "buildpacks", "dockerfile"}
+
+// delete asks the backend to remove an app. Drain is how many seconds a
+// graceful delete waits after the route is gone, 0 for the backend default.
 type delete struct {
 	Appname string `json:"appname"`
 	UserId  string `json:"userid"`
 	Force   bool   `json:"force"`
+	Drain   int    `json:"drain,omitempty"`
+}
+
+const maxDrainSeconds = 300
+
+// update asks the backend to apply a change to an app's cluster resources.
+// Sensitive values only travel in Sealed, see sealValues.
+type update struct {
+	AppName string            `json:"appname"`
+	Kind    string            `json:"kind"`
+	UserId  string            `json:"userid"`
+	Data    map[string]string `json:"data,omitempty"`
+	Sealed  string            `json:"sealed,omitempty"`
+}
+
+func queueUpdate(ctx context.Context, data update) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return rdb.LPush(ctx, "update_queue", payload).Err()
 }
 
 func GenerateDepID() string {
@@ -74,6 +106,13 @@ func GenerateDepID() string {
 	return "dep-" + string(result)
 }
 
+var gitRefPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+
+// validGitRef accepts branch names, tags and commit SHAs.
+func validGitRef(ref string) bool {
+	return len(ref) <= 200 && gitRefPattern.MatchString(ref) && !strings.Contains(ref, "..")
+}
+
 func Health(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
@@ -86,13 +125,46 @@ func createe(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
 		return
 	}
-	if data.GitRepo == "" || data.UserId == "" || data.AppName == "" {
+	if data.GitRepo == "" || data.AppName == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "missing fields"})
 		return
 	}
+	if !validAppName(data.AppName) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid app name"})
+		return
+	}
+	if data.Ref != "" && !validGitRef(data.Ref) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid git ref"})
+		return
+	}
+	if !slices.Contains(buildModes, data.BuildMode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "buildmode must be auto, buildpacks or dockerfile"})
+		return
+	}
+
+	data.UserId = currentUser(c)
+
+	// claim the name first so two creates of a new name can not both win;
+	// whoever loses needs owner or collaborator access like any redeploy
+	if err := claimApp(context.Background(), data.AppName, data.UserId); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	if authorizeApp(c, data.AppName, false) == nil {
+		return
+	}
 
 	data.DepID = GenerateDepID()
 
+	if err := registerApp(context.Background(), data); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	if err := queueDeployment(context.Background(), data.DepID, data.AppName, data.Ref); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+
 	payload, err := json.Marshal(data)
 	if err != nil {
 		c.JSON(500, gin.H{"error": "marshal failed"})
@@ -119,10 +191,29 @@ func deletee(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
 		return
 	}
-	if data.Appname == "" || data.UserId == "" {
+	if data.Appname == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "missing fields"})
 		return
 	}
+	if data.Drain < 0 || data.Drain > maxDrainSeconds {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("drain must be between 0 and %d seconds", maxDrainSeconds)})
+		return
+	}
+	data.UserId = currentUser(c)
+
+	// only the owner may delete; unregistered leftovers are admin only
+	app, err := getApp(context.Background(), data.Appname)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	if app == nil && !isAdmin(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "app not found"})
+		return
+	}
+	if app != nil && authorizeApp(c, data.Appname, true) == nil {
+		return
+	}
 
 	payload, err := json.Marshal(data)
 	if err != nil {
@@ -130,8 +221,27 @@ func deletee(c *gin.Context) {
 		return
 	}
 
+	owner := ""
+	if app != nil {
+		owner = app.UserId
+	}
+	if err := queueDeletion(context.Background(), data.Appname, owner, data.UserId, data.Force); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+
+	// before queuing, once queued the backend may remove the record any time
+	if app != nil {
+		if err := setAppStatus(context.Background(), data.Appname, "deleting"); err != nil {
+			log.Printf("⚠️ could not update app %s: %v", data.Appname, err)
+		}
+	}
+
 	err = rdb.LPush(context.Background(), queue, payload).Err()
 	if err != nil {
+		if app != nil {
+			setAppStatus(context.Background(), data.Appname, app.Status)
+		}
 		c.JSON(500, gin.H{"error": "redis error"})
 		return
 	}
@@ -144,6 +254,9 @@ func streamLogs(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing 'app' query parameter"})
 		return
 	}
+	if authorizeApp(c, appName, false) == nil {
+		return
+	}
 
 	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -191,9 +304,38 @@ func main() {
 	LoadEnv()
 
 	r.GET("/health", Health)
-	r.POST("/create", createe)
-	r.POST("/delete", deletee)
-	r.GET("/logs", streamLogs)
+	r.POST("/login", loginn)
+
+	auth := r.Group("/", AuthRequired())
+	auth.POST("/create", createe)
+	auth.POST("/delete", deletee)
+	auth.GET("/logs", streamLogs)
+	auth.GET("/apps", listApps)
+	auth.GET("/apps/:name", getAppInfo)
+	auth.GET("/apps/:name/releases", listReleases)
+	auth.GET("/apps/:name/collaborators", listCollaborators)
+	auth.POST("/apps/:name/collaborators", addCollaborator)
+	auth.DELETE("/apps/:name/collaborators/:userid", removeCollaborator)
+	auth.GET("/apps/:name/gitauth", getGitAuth)
+	auth.POST("/apps/:name/gitauth", setGitAuth)
+	auth.DELETE("/apps/:name/gitauth", deleteGitAuth)
+	auth.GET("/apps/:name/config", getConfig)
+	auth.POST("/apps/:name/config", setConfig)
+	auth.DELETE("/apps/:name/config", unsetConfig)
+	auth.GET("/apps/:name/secrets", listSecrets)
+	auth.POST("/apps/:name/secrets", setSecrets)
+	auth.DELETE("/apps/:name/secrets", unsetSecrets)
+	auth.POST("/apps/:name/port", setPort)
+	auth.POST("/apps/:name/scale", scaleApp)
+	auth.POST("/apps/:name/resize", resizeApp)
+	auth.POST("/apps/:name/autoscale", setAutoscale)
+	auth.DELETE("/apps/:name/autoscale", deleteAutoscale)
+	auth.POST("/apps/:name/healthcheck", setHealthCheck)
+	auth.DELETE("/apps/:name/healthcheck", resetHealthCheck)
+	auth.GET("/apps/:name/deletion", getDeletion)
+	auth.POST("/apps/:name/rollback", rollbackApp)
+	auth.GET("/deployments/:depid", getDeploymentInfo)
+	auth.POST("/deployments/:depid/cancel", cancelDeployment)
 
 	r.Run(":8080")
 }
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// App is the registry record kept in redis under app:<name>. The api writes
+// it when a create or delete is queued and the backend keeps status, depid
+// and url up to date while the pipeline runs.
+type App struct {
+	Name            string `json:"name" redis:"name"`
+	UserId          string `json:"userid" redis:"userid"`
+	GitRepo         string `json:"gitrepo" redis:"gitrepo"`
+	Ref             string `json:"ref" redis:"ref"`
+	DepID           string `json:"depid" redis:"depid"`
+	URL             string `json:"url" redis:"url"`
+	GitAuth         string `json:"gitauth,omitempty" redis:"gitauth"`
+	Port            int    `json:"port,omitempty" redis:"port"`
+	Replicas        string `json:"replicas,omitempty" redis:"replicas"`
+	CPU             string `json:"cpu,omitempty" redis:"cpu"`
+	Memory          string `json:"memory,omitempty" redis:"memory"`
+	AutoscaleMin    int    `json:"autoscale_min,omitempty" redis:"autoscale_min"`
+	AutoscaleMax    int    `json:"autoscale_max,omitempty" redis:"autoscale_max"`
+	AutoscaleCPU    int    `json:"autoscale_cpu,omitempty" redis:"autoscale_cpu"`
+	AutoscaleMemory int    `json:"autoscale_memory,omitempty" redis:"autoscale_memory"`
+	HealthPath      string `json:"health_path,omitempty" redis:"health_path"`
+	HealthPort      int    `json:"health_port,omitempty" redis:"health_port"`
+	Status          string `json:"status" redis:"status"`
+	CreatedAt       int64  `json:"created_at" redis:"created_at"`
+	UpdatedAt       int64  `json:"updated_at" redis:"updated_at"`
+}
+
+type collaborator struct {
+	UserId string `json:"userid"`
+}
+
+const appsSet = "apps"
+
+var appNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// namespaces the platform itself runs in, never usable as app names
+var reservedNames = map[string]bool{
+	"default":            true,
+	"kube-system":        true,
+	"kube-public":        true,
+	"kube-node-lease":    true,
+	"builder":            true,
+	"registory":          true,
+	"forge-paas-control": true,
+	"forge-system":       true,
+}
+
+// validAppName keeps app names usable as a namespace and inside the
+// build-<app><depid> job name.
+func validAppName(name string) bool {
+	return len(name) <= 40 && appNamePattern.MatchString(name) && !reservedNames[name]
+}
+
+func appKey(name string) string {
+	return "app:" + name
+}
+
+// getApp returns nil without an error when the app is not registered.
+func getApp(ctx context.Context, name string) (*App, error) {
+	res := rdb.HGetAll(ctx, appKey(name))
+	if err := res.Err(); err != nil {
+		return nil, err
+	}
+	if len(res.Val()) == 0 {
+		return nil, nil
+	}
+
+	var app App
+	if err := res.Scan(&app); err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+func registerApp(ctx context.Context, data create) error {
+	now := time.Now().Unix()
+	key := appKey(data.AppName)
+
+	pipe := rdb.TxPipeline()
+	pipe.HSetNX(ctx, key, "created_at", now)
+	// the first creator owns the app, redeploys by collaborators keep it
+	pipe.HSetNX(ctx, key, "userid", data.UserId)
+	pipe.HSet(ctx, key,
+		"name", data.AppName,
+		"gitrepo", data.GitRepo,
+		"ref", data.Ref,
+		"depid", data.DepID,
+		"status", "queued",
+		"updated_at", now,
+	)
+	pipe.SAdd(ctx, appsSet, data.AppName)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func collaboratorsKey(name string) string {
+	return appKey(name) + ":collaborators"
+}
+
+// canAccess reports whether userid owns the app or is one of its collaborators.
+func canAccess(ctx context.Context, app *App, userid string) (bool, error) {
+	if app.UserId == userid {
+		return true, nil
+	}
+	return rdb.SIsMember(ctx, collaboratorsKey(app.Name), userid).Result()
+}
+
+// authorizeApp loads an app for the calling user. Owners always pass,
+// collaborators only when ownerOnly is false and admins always. On failure
+// it writes the 404/403 response and returns nil.
+func authorizeApp(c *gin.Context, name string, ownerOnly bool) *App {
+	ctx := context.Background()
+
+	app, err := getApp(ctx, name)
+	if err != nil {
+		c.AbortWithStatusJSON(500, gin.H{"error": "redis error"})
+		return nil
+	}
+	if app == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "app not found"})
+		return nil
+	}
+	if isAdmin(c) {
+		return app
+	}
+
+	userid := currentUser(c)
+	allowed := app.UserId == userid
+	if !allowed && !ownerOnly {
+		allowed, err = canAccess(ctx, app, userid)
+		if err != nil {
+			c.AbortWithStatusJSON(500, gin.H{"error": "redis error"})
+			return nil
+		}
+	}
+	if !allowed {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "you do not have access to this app"})
+		return nil
+	}
+	return app
+}
+
+// claimApp registers an app name for userid before its first create, so
+// settings such as git credentials can be attached up front. Existing apps
+// are left untouched. Callers validate (and seal) the request first so a
+// rejected request never leaves a claimed name behind.
+func claimApp(ctx context.Context, name string, userid string) error {
+	key := appKey(name)
+	now := time.Now().Unix()
+
+	pipe := rdb.TxPipeline()
+	pipe.HSetNX(ctx, key, "name", name)
+	pipe.HSetNX(ctx, key, "userid", userid)
+	pipe.HSetNX(ctx, key, "status", "new")
+	pipe.HSetNX(ctx, key, "created_at", now)
+	pipe.HSetNX(ctx, key, "updated_at", now)
+	pipe.SAdd(ctx, appsSet, name)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// updateExisting sets hash fields only when the hash is there, so a late
+// write never brings back a record the backend already removed.
+var updateExisting = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+  return 0
+end
+redis.call("HSET", KEYS[1], unpack(ARGV))
+return 1
+`)
+
+// updateApp sets fields on the app record, false when it has been removed.
+func updateApp(ctx context.Context, name string, fields ...any) (bool, error) {
+	updated, err := updateExisting.Run(ctx, rdb, []string{appKey(name)}, fields...).Int()
+	return updated == 1, err
+}
+
+func setAppStatus(ctx context.Context, name string, status string) error {
+	_, err := updateApp(ctx, name,
+		"status", status,
+		"updated_at", time.Now().Unix(),
+	)
+	return err
+}
+
+func listApps(c *gin.Context) {
+	ctx := context.Background()
+	userid := currentUser(c)
+	// admins see every app, like they pass every ownership check
+	admin := isAdmin(c)
+
+	names, err := rdb.SMembers(ctx, appsSet).Result()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	sort.Strings(names)
+
+	apps := []App{}
+	for _, name := range names {
+		app, err := getApp(ctx, name)
+		if err != nil {
+			log.Printf("⚠️ could not load app %s: %v", name, err)
+			continue
+		}
+		if app == nil {
+			continue
+		}
+		if !admin {
+			allowed, err := canAccess(ctx, app, userid)
+			if err != nil || !allowed {
+				continue
+			}
+		}
+		apps = append(apps, *app)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"apps": apps})
+}
+
+func getAppInfo(c *gin.Context) {
+	app := authorizeApp(c, c.Param("name"), false)
+	if app == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, app)
+}
+
+func listCollaborators(c *gin.Context) {
+	app := authorizeApp(c, c.Param("name"), false)
+	if app == nil {
+		return
+	}
+
+	users, err := rdb.SMembers(context.Background(), collaboratorsKey(app.Name)).Result()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	sort.Strings(users)
+
+	c.JSON(http.StatusOK, gin.H{
+		"owner":         app.UserId,
+		"collaborators": users,
+	})
+}
+
+func addCollaborator(c *gin.Context) {
+	var data collaborator
+
+	app := authorizeApp(c, c.Param("name"), true)
+	if app == nil {
+		return
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	if data.UserId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing fields"})
+		return
+	}
+
+	if err := rdb.SAdd(context.Background(), collaboratorsKey(app.Name), data.UserId).Err(); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func removeCollaborator(c *gin.Context) {
+	app := authorizeApp(c, c.Param("name"), true)
+	if app == nil {
+		return
+	}
+
+	if err := rdb.SRem(context.Background(), collaboratorsKey(app.Name), c.Param("userid")).Err(); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Tokens are only ever stored as sha256 hashes: token:<hash> holds the user
+// id and user:<id>:tokens the set of hashes issued to that user.
+
+type login struct {
+	UserId string `json:"userid"`
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func GenerateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "fgp_" + hex.EncodeToString(buf), nil
+}
+
+func issueToken(ctx context.Context, userid string) (string, error) {
+	token, err := GenerateToken()
+	if err != nil {
+		return "", err
+	}
+	hash := hashToken(token)
+
+	pipe := rdb.TxPipeline()
+	pipe.Set(ctx, "token:"+hash, userid, 0)
+	pipe.SAdd(ctx, "user:"+userid+":tokens", hash)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// tokenUser returns the user a token was issued to, or "" if it is unknown.
+func tokenUser(ctx context.Context, token string) (string, error) {
+	userid, err := rdb.Get(ctx, "token:"+hashToken(token)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return userid, err
+}
+
+func bearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+func isAdmin(c *gin.Context) bool {
+	admin := os.Getenv("ADMIN_TOKEN")
+	if admin == "" {
+		return false
+	}
+	given := c.GetHeader("X-Admin-Token")
+	return subtle.ConstantTimeCompare([]byte(given), []byte(admin)) == 1
+}
+
+// AuthRequired rejects requests without a valid bearer token and stores the
+// token owner under "userid" for the handlers.
+func AuthRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := bearerToken(c)
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing bearer token"})
+			return
+		}
+
+		userid, err := tokenUser(context.Background(), token)
+		if err != nil {
+			c.AbortWithStatusJSON(500, gin.H{"error": "redis error"})
+			return
+		}
+		if userid == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			return
+		}
+
+		c.Set("userid", userid)
+		c.Next()
+	}
+}
+
+func currentUser(c *gin.Context) string {
+	return c.GetString("userid")
+}
+
+// ownsApps reports whether any app is registered to userid. Apps created
+// before logins existed carry owner ids that were never claimed.
+func ownsApps(ctx context.Context, userid string) (bool, error) {
+	names, err := rdb.SMembers(ctx, appsSet).Result()
+	if err != nil {
+		return false, err
+	}
+	for _, name := range names {
+		owner, err := rdb.HGet(ctx, appKey(name), "userid").Result()
+		if err != nil && err != redis.Nil {
+			return false, err
+		}
+		if owner == userid {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// loginn issues a token. A new user id is claimed by its first login; after
+// that a token is only issued to a caller already holding one for the same
+// user, or to an admin presenting ADMIN_TOKEN. An unclaimed id that already
+// owns apps can only be claimed through an admin, since its apps' owner ids
+// are visible to others.
+func loginn(c *gin.Context) {
+	var data login
+	ctx := context.Background()
+
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	if data.UserId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing fields"})
+		return
+	}
+
+	if !isAdmin(c) {
+		known, err := rdb.Exists(ctx, "user:"+data.UserId).Result()
+		if err != nil {
+			c.JSON(500, gin.H{"error": "redis error"})
+			return
+		}
+		if known == 0 {
+			owner, err := ownsApps(ctx, data.UserId)
+			if err != nil {
+				c.JSON(500, gin.H{"error": "redis error"})
+				return
+			}
+			if owner {
+				c.JSON(http.StatusForbidden, gin.H{"error": "user id owns existing apps, ask an admin to issue its first token"})
+				return
+			}
+		}
+	}
+
+	claimed, err := rdb.HSetNX(ctx, "user:"+data.UserId, "created_at", time.Now().Unix()).Result()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+
+	if !claimed && !isAdmin(c) {
+		owner := ""
+		if token := bearerToken(c); token != "" {
+			owner, err = tokenUser(ctx, token)
+			if err != nil {
+				c.JSON(500, gin.H{"error": "redis error"})
+				return
+			}
+		}
+		if owner != data.UserId {
+			c.JSON(http.StatusForbidden, gin.H{"error": "user already registered"})
+			return
+		}
+	}
+
+	token, err := issueToken(ctx, data.UserId)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "token issue failed"})
+		return
+	}
+
+	log.Printf("🔑 token issued for %s", data.UserId)
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+		"userid": data.UserId,
+		"token":  token,
+	})
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type autoscaleRequest struct {
+	Min    int `json:"min"`
+	Max    int `json:"max"`
+	CPU    int `json:"cpu"`
+	Memory int `json:"memory"`
+}
+
+var autoscaleFields = []string{"autoscale_min", "autoscale_max", "autoscale_cpu", "autoscale_memory"}
+
+// setAutoscale turns on autoscaling between min and max replicas, aiming at
+// the given cpu and/or memory utilization percent.
+func setAutoscale(c *gin.Context) {
+	var data autoscaleRequest
+	ctx := context.Background()
+
+	app := authorizeApp(c, c.Param("name"), false)
+	if app == nil {
+		return
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	if data.Min < 1 || data.Max > maxReplicas || data.Min > data.Max {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "need 1 <= min <= max <= " + strconv.Itoa(maxReplicas)})
+		return
+	}
+	if data.CPU == 0 && data.Memory == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "set a cpu and/or memory target"})
+		return
+	}
+	if data.CPU < 0 || data.CPU > 100 || data.Memory < 0 || data.Memory > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "targets are utilization percent between 1 and 100"})
+		return
+	}
+
+	found, err := updateApp(ctx, app.Name,
+		"autoscale_min", data.Min,
+		"autoscale_max", data.Max,
+		"autoscale_cpu", data.CPU,
+		"autoscale_memory", data.Memory,
+		"updated_at", time.Now().Unix(),
+	)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "app not found"})
+		return
+	}
+	if err := queueUpdate(ctx, update{AppName: app.Name, Kind: "autoscale", UserId: currentUser(c)}); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func deleteAutoscale(c *gin.Context) {
+	ctx := context.Background()
+
+	app := authorizeApp(c, c.Param("name"), false)
+	if app == nil {
+		return
+	}
+
+	if err := rdb.HDel(ctx, appKey(app.Name), autoscaleFields...).Err(); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	if err := queueUpdate(ctx, update{AppName: app.Name, Kind: "autoscale-delete", UserId: currentUser(c)}); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
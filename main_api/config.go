@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// App environment lives in config:<app>. Every change is followed by a
+// "config" update so the backend rewrites the ConfigMap and restarts pods.
+
+type configVars struct {
+	Vars map[string]string `json:"vars"`
+}
+
+type configKeys struct {
+	Keys []string `json:"keys"`
+}
+
+var envKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func configKey(name string) string {
+	return "config:" + name
+}
+
+func getConfig(c *gin.Context) {
+	app := authorizeApp(c, c.Param("name"), false)
+	if app == nil {
+		return
+	}
+
+	vars, err := rdb.HGetAll(context.Background(), configKey(app.Name)).Result()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"vars": vars})
+}
+
+func setConfig(c *gin.Context) {
+	var data configVars
+	ctx := context.Background()
+	name := c.Param("name")
+
+	if !validAppName(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid app name"})
+		return
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	if len(data.Vars) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing fields"})
+		return
+	}
+	for key := range data.Vars {
+		if !envKeyPattern.MatchString(key) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid variable name: " + key})
+			return
+		}
+	}
+
+	if err := claimApp(ctx, name, currentUser(c)); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	if authorizeApp(c, name, false) == nil {
+		return
+	}
+
+	if err := rdb.HSet(ctx, configKey(name), data.Vars).Err(); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	if err := queueUpdate(ctx, update{AppName: name, Kind: "config", UserId: currentUser(c)}); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func unsetConfig(c *gin.Context) {
+	var data configKeys
+	ctx := context.Background()
+
+	app := authorizeApp(c, c.Param("name"), false)
+	if app == nil {
+		return
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	if len(data.Keys) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing fields"})
+		return
+	}
+
+	if err := rdb.HDel(ctx, configKey(app.Name), data.Keys...).Err(); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	if err := queueUpdate(ctx, update{AppName: app.Name, Kind: "config", UserId: currentUser(c)}); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
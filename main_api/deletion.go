@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Deletion is the view of deletion:<app>. The api writes it when a delete
+// is queued and the backend fills in what it removed. It is kept for a day
+// after the app itself is gone.
+type Deletion struct {
+	App        string            `json:"app"`
+	State      string            `json:"state"`
+	Force      bool              `json:"force"`
+	UserId     string            `json:"userid"`
+	Owner      string            `json:"owner,omitempty"`
+	Removed    []string          `json:"removed"`
+	Missing    []string          `json:"missing"`
+	Failed     map[string]string `json:"failed,omitempty"`
+	Timestamps map[string]int64  `json:"timestamps"`
+}
+
+func deletionKey(name string) string {
+	return "deletion:" + name
+}
+
+func queueDeletion(ctx context.Context, name string, owner string, userid string, force bool) error {
+	now := time.Now().Unix()
+
+	pipe := rdb.TxPipeline()
+	pipe.Del(ctx, deletionKey(name))
+	pipe.HSet(ctx, deletionKey(name),
+		"app", name,
+		"state", "queued",
+		"force", force,
+		"userid", userid,
+		"owner", owner,
+		"queued_at", now,
+		"updated_at", now,
+	)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func splitList(value string) []string {
+	if value == "" {
+		return []string{}
+	}
+	return strings.Split(value, ",")
+}
+
+// getDeletion reports how the delete of an app went. The app record may be
+// gone already, so access is checked against the requester and the owner
+// kept on the deletion record.
+func getDeletion(c *gin.Context) {
+	name := c.Param("name")
+
+	fields, err := rdb.HGetAll(context.Background(), deletionKey(name)).Result()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	if len(fields) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no delete recorded for this app"})
+		return
+	}
+	userid := currentUser(c)
+	if !isAdmin(c) && fields["userid"] != userid && fields["owner"] != userid {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you do not have access to this app"})
+		return
+	}
+
+	del := Deletion{
+		App:        fields["app"],
+		State:      fields["state"],
+		Force:      fields["force"] == "1" || fields["force"] == "true",
+		UserId:     fields["userid"],
+		Owner:      fields["owner"],
+		Removed:    splitList(fields["removed"]),
+		Missing:    splitList(fields["missing"]),
+		Timestamps: map[string]int64{},
+	}
+	if fields["failed"] != "" {
+		json.Unmarshal([]byte(fields["failed"]), &del.Failed)
+	}
+	for field, value := range fields {
+		state, ok := strings.CutSuffix(field, "_at")
+		if !ok {
+			continue
+		}
+		if ts, err := strconv.ParseInt(value, 10, 64); err == nil {
+			del.Timestamps[state] = ts
+		}
+	}
+
+	c.JSON(http.StatusOK, del)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Deployment is the view of deployment:<depid>. The api writes the initial
+// queued record and the backend moves it through cloning, building, pushing,
+// deploying, routing and finally live, failed or cancelled.
+type Deployment struct {
+	DepID      string           `json:"depid"`
+	App        string           `json:"app"`
+	State      string           `json:"state"`
+	Reason     string           `json:"reason,omitempty"`
+	Ref        string           `json:"ref,omitempty"`
+	Commit     string           `json:"commit,omitempty"`
+	BuildMode  string           `json:"build_mode,omitempty"`
+	Digest     string           `json:"digest,omitempty"`
+	Buildpacks []string         `json:"buildpacks,omitempty"`
+	BuildTime  int64            `json:"build_duration,omitempty"`
+	CreatedAt  int64            `json:"created_at"`
+	UpdatedAt  int64            `json:"updated_at"`
+	Timestamps map[string]int64 `json:"timestamps"`
+}
+
+func deploymentKey(depid string) string {
+	return "deployment:" + depid
+}
+
+func queueDeployment(ctx context.Context, depid string, appname string, ref string) error {
+	now := time.Now().Unix()
+	return rdb.HSet(ctx, deploymentKey(depid),
+		"depid", depid,
+		"app", appname,
+		"ref", ref,
+		"state", "queued",
+		"queued_at", now,
+		"created_at", now,
+		"updated_at", now,
+	).Err()
+}
+
+// getDeployment returns nil without an error when the deployment is unknown.
+func getDeployment(ctx context.Context, depid string) (*Deployment, error) {
+	fields, err := rdb.HGetAll(ctx, deploymentKey(depid)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	dep := &Deployment{
+		DepID:      fields["depid"],
+		App:        fields["app"],
+		State:      fields["state"],
+		Reason:     fields["reason"],
+		Ref:        fields["ref"],
+		Commit:     fields["commit"],
+		BuildMode:  fields["build_mode"],
+		Digest:     fields["digest"],
+		Buildpacks: splitList(fields["buildpacks"]),
+		Timestamps: map[string]int64{},
+	}
+	for field, value := range fields {
+		ts, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		switch field {
+		case "created_at":
+			dep.CreatedAt = ts
+		case "updated_at":
+			dep.UpdatedAt = ts
+		case "build_duration":
+			dep.BuildTime = ts
+		default:
+			if state, ok := strings.CutSuffix(field, "_at"); ok {
+				dep.Timestamps[state] = ts
+			}
+		}
+	}
+	return dep, nil
+}
+
+func getDeploymentInfo(c *gin.Context) {
+	depid := c.Param("depid")
+
+	dep, err := getDeployment(context.Background(), depid)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	if dep == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
+		return
+	}
+	if authorizeApp(c, dep.App, false) == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, dep)
+}
+
+// cancellable are the states in which a deployment is still building.
+var cancellable = map[string]bool{
+	"queued":   true,
+	"cloning":  true,
+	"building": true,
+	"pushing":  true,
+}
+
+type cancel struct {
+	AppName string `json:"appname"`
+	DepID   string `json:"depid"`
+	UserId  string `json:"userid"`
+}
+
+func cancelDeployment(c *gin.Context) {
+	depid := c.Param("depid")
+	ctx := context.Background()
+
+	dep, err := getDeployment(ctx, depid)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	if dep == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
+		return
+	}
+	if authorizeApp(c, dep.App, false) == nil {
+		return
+	}
+	if !cancellable[dep.State] {
+		c.JSON(http.StatusConflict, gin.H{"error": "deployment is " + dep.State + ", only builds in progress can be cancelled"})
+		return
+	}
+
+	payload, err := json.Marshal(cancel{AppName: dep.App, DepID: depid, UserId: currentUser(c)})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "marshal failed"})
+		return
+	}
+	if err := rdb.LPush(ctx, "cancel_queue", payload).Err(); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "cancelling", "depid": depid, "app": dep.App})
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type gitAuth struct {
+	Type       string `json:"type"`
+	SSHKey     string `json:"ssh_key"`
+	KnownHosts string `json:"known_hosts"`
+	Username   string `json:"username"`
+	Token      string `json:"token"`
+}
+
+// setGitAuth registers a deploy key or https token for cloning a private
+// repo. It can be called before the first create, which claims the app name
+// for the caller. The credential is sealed and handed to the backend, which
+// stores it as a Secret in the builder namespace; redis only keeps the type.
+func setGitAuth(c *gin.Context) {
+	var data gitAuth
+	ctx := context.Background()
+	name := c.Param("name")
+
+	if !validAppName(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid app name"})
+		return
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+
+	values := map[string]string{}
+	switch data.Type {
+	case "ssh":
+		if data.SSHKey == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "missing ssh_key"})
+			return
+		}
+		values["ssh-privatekey"] = data.SSHKey
+		if data.KnownHosts != "" {
+			values["known_hosts"] = data.KnownHosts
+		}
+	case "token":
+		if data.Token == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "missing token"})
+			return
+		}
+		if data.Username == "" {
+			data.Username = "git"
+		}
+		values["username"] = data.Username
+		values["password"] = data.Token
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be ssh or token"})
+		return
+	}
+
+	sealed, err := sealValues(values)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "secret storage is not configured"})
+		return
+	}
+
+	if err := claimApp(ctx, name, currentUser(c)); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	if authorizeApp(c, name, true) == nil {
+		return
+	}
+
+	found, err := updateApp(ctx, name, "gitauth", data.Type, "updated_at", time.Now().Unix())
+	if err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "app not found"})
+		return
+	}
+
+	err = queueUpdate(ctx, update{
+		AppName: name,
+		Kind:    "gitauth",
+		UserId:  currentUser(c),
+		Data:    map[string]string{"type": data.Type},
+		Sealed:  sealed,
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "type": data.Type})
+}
+
+func getGitAuth(c *gin.Context) {
+	app := authorizeApp(c, c.Param("name"), false)
+	if app == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"configured": app.GitAuth != "",
+		"type":       app.GitAuth,
+	})
+}
+
+func deleteGitAuth(c *gin.Context) {
+	ctx := context.Background()
+
+	app := authorizeApp(c, c.Param("name"), true)
+	if app == nil {
+		return
+	}
+
+	err := queueUpdate(ctx, update{
+		AppName: app.Name,
+		Kind:    "gitauth-delete",
+		UserId:  currentUser(c),
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	if err := rdb.HDel(ctx, appKey(app.Name), "gitauth").Err(); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type healthRequest struct {
+	Path      string `json:"path"`
+	Port      int    `json:"port"`
+	Timeout   int    `json:"timeout"`
+	Threshold int    `json:"threshold"`
+	Startup   int    `json:"startup"`
+}
+
+var healthFields = []string{"health_path", "health_port", "health_timeout", "health_threshold", "health_startup"}
+
+// setHealthCheck configures the readiness, liveness and startup probes of
+// an app. Without a path the probes only check the port. Zero values keep
+// the platform defaults.
+func setHealthCheck(c *gin.Context) {
+	var data healthRequest
+	ctx := context.Background()
+
+	app := authorizeApp(c, c.Param("name"), false)
+	if app == nil {
+		return
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	if data.Path != "" && (!strings.HasPrefix(data.Path, "/") || strings.ContainsAny(data.Path, " \t\r\n")) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "path must start with / and contain no spaces"})
+		return
+	}
+	if data.Port < 0 || data.Port > 65535 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "port must be between 1 and 65535, or 0 for the app port"})
+		return
+	}
+	if data.Timeout < 0 || data.Timeout > 60 || data.Threshold < 0 || data.Threshold > 30 || data.Startup < 0 || data.Startup > 600 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "timeout must be at most 60s, threshold at most 30 and startup at most 600s"})
+		return
+	}
+
+	if err := rdb.HDel(ctx, appKey(app.Name), healthFields...).Err(); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	fields := []any{"updated_at", time.Now().Unix()}
+	for field, value := range map[string]any{
+		"health_path":      data.Path,
+		"health_port":      data.Port,
+		"health_timeout":   data.Timeout,
+		"health_threshold": data.Threshold,
+		"health_startup":   data.Startup,
+	} {
+		if value != "" && value != 0 {
+			fields = append(fields, field, value)
+		}
+	}
+	found, err := updateApp(ctx, app.Name, fields...)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "app not found"})
+		return
+	}
+	if err := queueUpdate(ctx, update{AppName: app.Name, Kind: "health", UserId: currentUser(c)}); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// resetHealthCheck goes back to the default port check.
+func resetHealthCheck(c *gin.Context) {
+	ctx := context.Background()
+
+	app := authorizeApp(c, c.Param("name"), false)
+	if app == nil {
+		return
+	}
+
+	if err := rdb.HDel(ctx, appKey(app.Name), healthFields...).Err(); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	if err := queueUpdate(ctx, update{AppName: app.Name, Kind: "health", UserId: currentUser(c)}); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type portRequest struct {
+	Port *int `json:"port"`
+}
+
+// setPort pins the port an app listens on. Port 0 clears it, the backend
+// then falls back to a PORT config var or 8080. Like config it can be set
+// before the first create.
+func setPort(c *gin.Context) {
+	var data portRequest
+	ctx := context.Background()
+	name := c.Param("name")
+
+	if !validAppName(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid app name"})
+		return
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	if data.Port == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing fields"})
+		return
+	}
+	port := *data.Port
+	if port < 0 || port > 65535 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "port must be between 1 and 65535, or 0 to reset"})
+		return
+	}
+
+	if err := claimApp(ctx, name, currentUser(c)); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	if authorizeApp(c, name, false) == nil {
+		return
+	}
+
+	var err error
+	found := true
+	if port == 0 {
+		err = rdb.HDel(ctx, appKey(name), "port").Err()
+	} else {
+		found, err = updateApp(ctx, name, "port", port, "updated_at", time.Now().Unix())
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "app not found"})
+		return
+	}
+
+	err = queueUpdate(ctx, update{
+		AppName: name,
+		Kind:    "port",
+		UserId:  currentUser(c),
+		Data:    map[string]string{"port": strconv.Itoa(port)},
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "port": port})
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Release mirrors the entries the backend pushes to releases:<app> each time
+// a deployment goes live, newest first.
+type Release struct {
+	DepID      string `json:"depid"`
+	Image      string `json:"image"`
+	GitRepo    string `json:"gitrepo"`
+	Ref        string `json:"ref,omitempty"`
+	Commit     string `json:"commit,omitempty"`
+	UserId     string `json:"userid"`
+	Timestamp  int64  `json:"timestamp"`
+	RollbackOf string `json:"rollback_of,omitempty"`
+}
+
+type rollback struct {
+	AppName     string `json:"appname"`
+	DepID       string `json:"depid"`
+	TargetDepID string `json:"target_depid"`
+	UserId      string `json:"userid"`
+}
+
+type rollbackRequest struct {
+	To string `json:"to"`
+}
+
+func getReleases(ctx context.Context, appname string) ([]Release, error) {
+	items, err := rdb.LRange(ctx, "releases:"+appname, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	releases := []Release{}
+	for _, item := range items {
+		var release Release
+		if err := json.Unmarshal([]byte(item), &release); err != nil {
+			log.Printf("⚠️ skipping bad release for %s: %v", appname, err)
+			continue
+		}
+		releases = append(releases, release)
+	}
+	return releases, nil
+}
+
+// rollbackTarget picks the release named by to, or by default the newest
+// release running a different image than the current one.
+func rollbackTarget(releases []Release, to string) *Release {
+	if len(releases) == 0 {
+		return nil
+	}
+
+	for i := range releases {
+		if to != "" {
+			if releases[i].DepID == to {
+				return &releases[i]
+			}
+			continue
+		}
+		if releases[i].Image != releases[0].Image {
+			return &releases[i]
+		}
+	}
+	return nil
+}
+
+func listReleases(c *gin.Context) {
+	app := authorizeApp(c, c.Param("name"), false)
+	if app == nil {
+		return
+	}
+
+	releases, err := getReleases(context.Background(), app.Name)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"releases": releases})
+}
+
+func rollbackApp(c *gin.Context) {
+	name := c.Param("name")
+	ctx := context.Background()
+
+	var req rollbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+
+	if authorizeApp(c, name, false) == nil {
+		return
+	}
+
+	releases, err := getReleases(ctx, name)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	target := rollbackTarget(releases, req.To)
+	if target == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no release to roll back to"})
+		return
+	}
+
+	data := rollback{
+		AppName:     name,
+		DepID:       GenerateDepID(),
+		TargetDepID: target.DepID,
+		UserId:      currentUser(c),
+	}
+
+	// a delete may have removed the app since it was authorized
+	found, err := updateApp(ctx, name, "depid", data.DepID, "status", "queued", "updated_at", time.Now().Unix())
+	if err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "app not found"})
+		return
+	}
+	if err := queueDeployment(ctx, data.DepID, name, target.Ref); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "marshal failed"})
+		return
+	}
+	if err := rdb.LPush(ctx, "rollback_queue", payload).Err(); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+		"depid":  data.DepID,
+		"target": target.DepID,
+		"image":  target.Image,
+	})
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Size tiers an app can be resized to. Requests are derived from these
+// limits by the backend.
+var (
+	cpuTiers    = []string{"250m", "500m", "1", "2"}
+	memoryTiers = []string{"256Mi", "512Mi", "1Gi", "2Gi", "4Gi"}
+)
+
+const maxReplicas = 10
+
+type scaleRequest struct {
+	Replicas *int `json:"replicas"`
+}
+
+type resizeRequest struct {
+	CPU    string `json:"cpu"`
+	Memory string `json:"memory"`
+}
+
+// scaleApp sets the replica count of an app. The backend patches the live
+// Deployment and later redeploys keep the count.
+func scaleApp(c *gin.Context) {
+	var data scaleRequest
+	ctx := context.Background()
+
+	app := authorizeApp(c, c.Param("name"), false)
+	if app == nil {
+		return
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	if data.Replicas == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing fields"})
+		return
+	}
+	if app.AutoscaleMax != 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "autoscaling is enabled, change its min and max instead"})
+		return
+	}
+	replicas := *data.Replicas
+	if replicas < 0 || replicas > maxReplicas {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "replicas must be between 0 and " + strconv.Itoa(maxReplicas)})
+		return
+	}
+
+	found, err := updateApp(ctx, app.Name, "replicas", replicas, "updated_at", time.Now().Unix())
+	if err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "app not found"})
+		return
+	}
+	err = queueUpdate(ctx, update{
+		AppName: app.Name,
+		Kind:    "scale",
+		UserId:  currentUser(c),
+		Data:    map[string]string{"replicas": strconv.Itoa(replicas)},
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "replicas": replicas})
+}
+
+// resizeApp moves an app to another cpu and/or memory tier. A value left
+// out keeps the current one.
+func resizeApp(c *gin.Context) {
+	var data resizeRequest
+	ctx := context.Background()
+
+	app := authorizeApp(c, c.Param("name"), false)
+	if app == nil {
+		return
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	if data.CPU == "" && data.Memory == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing fields"})
+		return
+	}
+	if data.CPU != "" && !slices.Contains(cpuTiers, data.CPU) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cpu must be one of " + strings.Join(cpuTiers, ", ")})
+		return
+	}
+	if data.Memory != "" && !slices.Contains(memoryTiers, data.Memory) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "memory must be one of " + strings.Join(memoryTiers, ", ")})
+		return
+	}
+
+	fields := []any{"updated_at", time.Now().Unix()}
+	if data.CPU != "" {
+		fields = append(fields, "cpu", data.CPU)
+	}
+	if data.Memory != "" {
+		fields = append(fields, "memory", data.Memory)
+	}
+	found, err := updateApp(ctx, app.Name, fields...)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "app not found"})
+		return
+	}
+	err = queueUpdate(ctx, update{
+		AppName: app.Name,
+		Kind:    "resize",
+		UserId:  currentUser(c),
+		Data:    map[string]string{"cpu": data.CPU, "memory": data.Memory},
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// sealValues encrypts sensitive values with AES-GCM under SECRETS_KEY (32
+// bytes, base64) before they go through redis. Only the backend, holding the
+// same key, can open them.
+func sealValues(values map[string]string) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(os.Getenv("SECRETS_KEY"))
+	if err != nil || len(key) != 32 {
+		return "", fmt.Errorf("SECRETS_KEY must be 32 base64 encoded bytes")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	plain, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plain, nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Secret values are sealed straight away and only ever reach the backend,
+// which writes them to the <app>-secrets Secret. Redis keeps the key names
+// in secrets:<app> so they can be listed; values are never returned.
+
+func secretsKey(name string) string {
+	return "secrets:" + name
+}
+
+func listSecrets(c *gin.Context) {
+	app := authorizeApp(c, c.Param("name"), false)
+	if app == nil {
+		return
+	}
+
+	keys, err := rdb.SMembers(context.Background(), secretsKey(app.Name)).Result()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	sort.Strings(keys)
+
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+func setSecrets(c *gin.Context) {
+	var data configVars
+	ctx := context.Background()
+	name := c.Param("name")
+
+	if !validAppName(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid app name"})
+		return
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	if len(data.Vars) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing fields"})
+		return
+	}
+
+	names := map[string]string{}
+	keys := []any{}
+	for key := range data.Vars {
+		if !envKeyPattern.MatchString(key) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid secret name: " + key})
+			return
+		}
+		names[key] = ""
+		keys = append(keys, key)
+	}
+
+	sealed, err := sealValues(data.Vars)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "secret storage is not configured"})
+		return
+	}
+
+	if err := claimApp(ctx, name, currentUser(c)); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	if authorizeApp(c, name, false) == nil {
+		return
+	}
+
+	err = queueUpdate(ctx, update{
+		AppName: name,
+		Kind:    "secrets-set",
+		UserId:  currentUser(c),
+		Data:    names,
+		Sealed:  sealed,
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	if err := rdb.SAdd(ctx, secretsKey(name), keys...).Err(); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func unsetSecrets(c *gin.Context) {
+	var data configKeys
+	ctx := context.Background()
+
+	app := authorizeApp(c, c.Param("name"), false)
+	if app == nil {
+		return
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	if len(data.Keys) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing fields"})
+		return
+	}
+
+	names := map[string]string{}
+	keys := []any{}
+	for _, key := range data.Keys {
+		names[key] = ""
+		keys = append(keys, key)
+	}
+
+	err := queueUpdate(ctx, update{
+		AppName: app.Name,
+		Kind:    "secrets-unset",
+		UserId:  currentUser(c),
+		Data:    names,
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+	if err := rdb.SRem(ctx, secretsKey(app.Name), keys...).Err(); err != nil {
+		c.JSON(500, gin.H{"error": "redis error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}